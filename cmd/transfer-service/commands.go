@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"transfer-service/internal/service"
+)
+
+const usage = `usage:
+  transfer-service                        run the HTTP gateway and background workers
+  transfer-service projections list       list registered projections
+  transfer-service projections rebuild <name>|all [--force]
+                                          drop a projection and replay it from the outbox;
+                                          --force replays even if retention purged events
+  transfer-service rollups rebuild [since]
+                                          recompute temperature rollups from raw readings
+                                          recorded since the RFC3339 time (default: oldest reading)
+  transfer-service retention run          archive and purge expired rows once`
+
+// runCommand executes a one-off CLI command and returns the process exit code.
+func runCommand(svc *service.CombinedService, args []string) int {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if len(args) >= 2 && args[0] == "rollups" && args[1] == "rebuild" {
+		return rebuildRollups(ctx, svc, args[2:])
+	}
+	if len(args) == 2 && args[0] == "retention" && args[1] == "run" {
+		n, err := svc.Retention.PurgeOnce(ctx)
+		if err != nil {
+			log.Error().Err(err).Int("rows", n).Msg("retention run failed")
+			return 1
+		}
+		log.Info().Int("rows", n).Msg("retention run finished")
+		return 0
+	}
+	if len(args) < 2 || args[0] != "projections" {
+		fmt.Fprintln(os.Stderr, usage)
+		return 2
+	}
+	runner := svc.Projections
+	switch args[1] {
+	case "list":
+		for _, p := range runner.Projections() {
+			fmt.Printf("%s\t%v\n", p.Name(), p.Topics())
+		}
+		return 0
+	case "rebuild":
+		force := len(args) == 4 && args[3] == "--force"
+		if len(args) != 3 && !force {
+			fmt.Fprintln(os.Stderr, usage)
+			return 2
+		}
+		targets := runner.Projections()
+		if args[2] != "all" {
+			p, err := runner.Get(args[2])
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				return 1
+			}
+			targets = []service.Projection{p}
+		}
+		for _, p := range targets {
+			name := p.Name()
+			err := runner.Rebuild(ctx, p, force, func(done, total int) {
+				pct := 100.0
+				if total > 0 {
+					pct = float64(done) * 100 / float64(total)
+				}
+				log.Info().Str("projection", name).Int("done", done).Int("total", total).Msgf("replaying %.1f%%", pct)
+			})
+			if err != nil {
+				log.Error().Err(err).Str("projection", name).Msg("rebuild failed")
+				return 1
+			}
+		}
+		return 0
+	default:
+		fmt.Fprintln(os.Stderr, usage)
+		return 2
+	}
+}
+
+func rebuildRollups(ctx context.Context, svc *service.CombinedService, args []string) int {
+	var since time.Time
+	switch len(args) {
+	case 0:
+	case 1:
+		t, err := time.Parse(time.RFC3339, args[0])
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "invalid since:", err)
+			return 2
+		}
+		since = t
+	default:
+		fmt.Fprintln(os.Stderr, usage)
+		return 2
+	}
+	if err := svc.Temperature.RebuildRollups(ctx, since); err != nil {
+		log.Error().Err(err).Msg("rollup rebuild failed")
+		return 1
+	}
+	return 0
+}
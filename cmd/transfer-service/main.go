@@ -6,7 +6,10 @@ import (
 	"fmt"
 	"net/http"
 	"os"
+	"os/signal"
 	"path/filepath"
+	"sync"
+	"syscall"
 	"time"
 
 	_ "transfer-service/docs" // penting untuk swagger
@@ -20,6 +23,7 @@ import (
 	httpSwagger "github.com/swaggo/http-swagger"
 
 	"transfer-service/internal/handler"
+	"transfer-service/internal/publisher"
 	"transfer-service/internal/repo"
 	"transfer-service/internal/service"
 )
@@ -85,7 +89,17 @@ func main() {
 	rep := repo.NewPostgresRepo(db)
 	transferSvc := service.NewTransferService(rep)
 	tempSvc := service.NewTemperatureService(rep)
-	combined := service.NewCombinedService(transferSvc, tempSvc, rep)
+	pub, err := publisher.FromEnv()
+	if err != nil {
+		log.Fatal().Err(err).Msg("outbox publisher")
+	}
+	relay := service.NewOutboxRelay(rep, pub)
+	combined := service.NewCombinedService(transferSvc, tempSvc, relay, rep)
+
+	// ====== CLI COMMANDS ======
+	if len(os.Args) > 1 {
+		os.Exit(runCommand(combined, os.Args[1:]))
+	}
 
 	// ====== ROUTER ======
 	r := chi.NewRouter()
@@ -95,10 +109,49 @@ func main() {
 	r.Handle("/metrics", promhttp.Handler())
 	r.Get("/swagger/*", httpSwagger.WrapHandler) // ✅ FIX Swagger handler
 
+	// ====== BACKGROUND WORKERS ======
+	runCtx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	var wg sync.WaitGroup
+	wg.Add(5)
+	go func() {
+		defer wg.Done()
+		combined.Relay.Run(runCtx)
+	}()
+	go func() {
+		defer wg.Done()
+		combined.Projections.Run(runCtx)
+	}()
+	go func() {
+		defer wg.Done()
+		combined.Temperature.RunOfflineMonitor(runCtx)
+	}()
+	go func() {
+		defer wg.Done()
+		combined.Retention.Run(runCtx)
+	}()
+	go func() {
+		defer wg.Done()
+		combined.Idempotency.RunPurger(runCtx)
+	}()
+
 	// ====== RUN SERVER ======
 	addr := ":8080"
-	log.Info().Msgf("starting gateway on %s", addr)
-	if err := http.ListenAndServe(addr, r); err != nil {
-		log.Fatal().Err(err).Msg("server stopped")
+	srv := &http.Server{Addr: addr, Handler: r}
+	go func() {
+		log.Info().Msgf("starting gateway on %s", addr)
+		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.Fatal().Err(err).Msg("server stopped")
+		}
+	}()
+
+	<-runCtx.Done()
+	log.Info().Msg("shutting down")
+	shutdownCtx, cancelShutdown := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancelShutdown()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		log.Error().Err(err).Msg("server shutdown")
 	}
+	wg.Wait()
 }
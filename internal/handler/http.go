@@ -2,7 +2,10 @@ package handler
 
 import (
     "encoding/json"
+    "errors"
     "net/http"
+    "strconv"
+    "strings"
     "time"
 
     "github.com/go-chi/chi/v5"
@@ -11,21 +14,58 @@ import (
 )
 
 // Routes mounts all routes for transfer+temperature under /api
-// @tags Transfers, Temperature, Dev, Monitoring
+// @tags Transfers, Locations, Pallets, Temperature, Inventory, Stats, Dev, Admin, Monitoring
 func Routes(svc *service.CombinedService) http.Handler {
     r := chi.NewRouter()
 
     // Transfer
-    r.Post("/transfers", createTransferHandler(svc))
-    r.Post("/transfers/{id}/accept", acceptTransferHandler(svc))
-    r.Post("/transfers/{id}/complete", completeTransferHandler(svc))
+    idem := r.With(Idempotent(svc))
+    idem.Post("/transfers", createTransferHandler(svc))
+    idem.Post("/transfers/{id}/accept", acceptTransferHandler(svc))
+    r.Post("/transfers/{id}/start", startTransferHandler(svc))
+    idem.Post("/transfers/{id}/complete", completeTransferHandler(svc))
+    r.Post("/transfers/{id}/reject", rejectTransferHandler(svc))
+    r.Post("/transfers/{id}/cancel", cancelTransferHandler(svc))
+    r.Get("/transfers", listTransfersHandler(svc))
     r.Get("/transfers/{id}", getTransferHandler(svc))
     r.Post("/dev/flush-outbox", flushOutboxHandler(svc))
 
     // Temperature
     r.Post("/temperatures", ingestTempHandler(svc))
     r.Get("/alerts", getAlertsHandler(svc))
+    r.Get("/alerts/{id}", getAlertHandler(svc))
+    r.Post("/alerts/{id}/ack", ackAlertHandler(svc))
+    r.Post("/alerts/{id}/resolve", resolveAlertHandler(svc))
     r.Post("/temperatures/dev/flush-outbox", flushOutboxHandler(svc))
+    r.Post("/rooms", createRoomHandler(svc))
+    r.Get("/rooms", listRoomsHandler(svc))
+    r.Get("/rooms/{id}", getRoomHandler(svc))
+    r.Put("/rooms/{id}", updateRoomHandler(svc))
+    r.Get("/rooms/{id}/temperatures", getRoomTemperaturesHandler(svc))
+
+    // Locations
+    r.Post("/locations", createLocationHandler(svc))
+    r.Get("/locations", listLocationsHandler(svc))
+    r.Get("/locations/{code}", getLocationHandler(svc))
+    r.Put("/locations/{code}", updateLocationHandler(svc))
+    r.Delete("/locations/{code}", deactivateLocationHandler(svc))
+
+    // Pallets
+    r.Post("/pallets", registerPalletHandler(svc))
+    r.Get("/pallets", listPalletsHandler(svc))
+    r.Get("/pallets/{sscc}", getPalletHandler(svc))
+
+    // Inventory
+    r.Get("/inventory/locations/{id}", getLocationInventoryHandler(svc))
+    r.Get("/inventory/pallets/{id}", getPalletInventoryHandler(svc))
+
+    // Stats
+    r.Get("/stats/rooms/alerts", getRoomAlertStatsHandler(svc))
+    r.Get("/stats/operators", getOperatorStatsHandler(svc))
+
+    // Admin
+    r.Get("/admin/outbox/dead-letters", listDeadLettersHandler(svc))
+    r.Post("/admin/outbox/dead-letters/{id}/requeue", requeueDeadLetterHandler(svc))
 
     return r
 }
@@ -40,6 +80,8 @@ func Routes(svc *service.CombinedService) http.Handler {
 // @Param request body service.CreateTransferRequest true "Transfer Request Body"
 // @Success 201 {object} service.Transfer
 // @Failure 400 {object} map[string]string
+// @Failure 409 {string} string
+// @Failure 422 {string} string "Idempotency-Key reused with a different body"
 // @Router /transfers [post]
 func createTransferHandler(svc *service.CombinedService) http.HandlerFunc {
     return func(w http.ResponseWriter, r *http.Request) {
@@ -53,7 +95,7 @@ func createTransferHandler(svc *service.CombinedService) http.HandlerFunc {
         tr, err := svc.Transfer.CreateTransfer(r.Context(), req, idempo)
         if err != nil {
             log.Error().Err(err).Msg("create transfer")
-            http.Error(w, err.Error(), http.StatusInternalServerError)
+            writeServiceError(w, err)
             return
         }
         w.WriteHeader(http.StatusCreated)
@@ -65,14 +107,48 @@ func createTransferHandler(svc *service.CombinedService) http.HandlerFunc {
 // @Summary Menerima transfer pallet
 // @Tags Transfers
 // @Param id path string true "Transfer ID"
+// @Param Idempotency-Key header string false "Idempotency Key"
 // @Success 200
+// @Failure 404 {string} string
+// @Failure 409 {string} string
+// @Failure 422 {string} string "Idempotency-Key reused with a different request"
 // @Router /transfers/{id}/accept [post]
 func acceptTransferHandler(svc *service.CombinedService) http.HandlerFunc {
     return func(w http.ResponseWriter, r *http.Request) {
         id := chi.URLParam(r, "id")
         if err := svc.Transfer.AcceptTransfer(r.Context(), id); err != nil {
             log.Error().Err(err).Msg("accept transfer")
-            http.Error(w, err.Error(), http.StatusInternalServerError)
+            writeServiceError(w, err)
+            return
+        }
+        w.WriteHeader(http.StatusOK)
+    }
+}
+
+// StartTransfer godoc
+// @Summary Memulai pemindahan pallet
+// @Description Operator mengambil pallet dengan forklift/peralatan tertentu; status menjadi in_progress.
+// @Tags Transfers
+// @Accept json
+// @Param id path string true "Transfer ID"
+// @Param request body service.StartTransferRequest true "Start Request Body"
+// @Success 200
+// @Failure 400 {string} string
+// @Failure 404 {string} string
+// @Failure 409 {string} string
+// @Router /transfers/{id}/start [post]
+func startTransferHandler(svc *service.CombinedService) http.HandlerFunc {
+    return func(w http.ResponseWriter, r *http.Request) {
+        id := chi.URLParam(r, "id")
+        var req service.StartTransferRequest
+        if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+            log.Error().Err(err).Msg("invalid body")
+            http.Error(w, "invalid body", http.StatusBadRequest)
+            return
+        }
+        if err := svc.Transfer.StartTransfer(r.Context(), id, req); err != nil {
+            log.Error().Err(err).Msg("start transfer")
+            writeServiceError(w, err)
             return
         }
         w.WriteHeader(http.StatusOK)
@@ -83,20 +159,142 @@ func acceptTransferHandler(svc *service.CombinedService) http.HandlerFunc {
 // @Summary Menyelesaikan transfer pallet
 // @Tags Transfers
 // @Param id path string true "Transfer ID"
+// @Param Idempotency-Key header string false "Idempotency Key"
 // @Success 200
+// @Failure 404 {string} string
+// @Failure 409 {string} string
+// @Failure 422 {string} string "Idempotency-Key reused with a different request"
 // @Router /transfers/{id}/complete [post]
 func completeTransferHandler(svc *service.CombinedService) http.HandlerFunc {
     return func(w http.ResponseWriter, r *http.Request) {
         id := chi.URLParam(r, "id")
         if err := svc.Transfer.CompleteTransfer(r.Context(), id); err != nil {
             log.Error().Err(err).Msg("complete transfer")
-            http.Error(w, err.Error(), http.StatusInternalServerError)
+            writeServiceError(w, err)
             return
         }
         w.WriteHeader(http.StatusOK)
     }
 }
 
+// RejectTransfer godoc
+// @Summary Menolak transfer pallet
+// @Description Supervisor menolak transfer yang masih pending beserta alasannya.
+// @Tags Transfers
+// @Accept json
+// @Param id path string true "Transfer ID"
+// @Param request body service.RejectTransferRequest true "Reject Request Body"
+// @Success 200
+// @Failure 400 {string} string
+// @Failure 404 {string} string
+// @Failure 409 {string} string
+// @Router /transfers/{id}/reject [post]
+func rejectTransferHandler(svc *service.CombinedService) http.HandlerFunc {
+    return func(w http.ResponseWriter, r *http.Request) {
+        id := chi.URLParam(r, "id")
+        var req service.RejectTransferRequest
+        if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+            log.Error().Err(err).Msg("invalid body")
+            http.Error(w, "invalid body", http.StatusBadRequest)
+            return
+        }
+        if err := svc.Transfer.RejectTransfer(r.Context(), id, req); err != nil {
+            log.Error().Err(err).Msg("reject transfer")
+            writeServiceError(w, err)
+            return
+        }
+        w.WriteHeader(http.StatusOK)
+    }
+}
+
+// CancelTransfer godoc
+// @Summary Membatalkan transfer pallet
+// @Description Requester membatalkan transfer yang belum dipindahkan.
+// @Tags Transfers
+// @Accept json
+// @Param id path string true "Transfer ID"
+// @Param request body service.CancelTransferRequest true "Cancel Request Body"
+// @Success 200
+// @Failure 400 {string} string
+// @Failure 403 {string} string
+// @Failure 404 {string} string
+// @Failure 409 {string} string
+// @Router /transfers/{id}/cancel [post]
+func cancelTransferHandler(svc *service.CombinedService) http.HandlerFunc {
+    return func(w http.ResponseWriter, r *http.Request) {
+        id := chi.URLParam(r, "id")
+        var req service.CancelTransferRequest
+        if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+            log.Error().Err(err).Msg("invalid body")
+            http.Error(w, "invalid body", http.StatusBadRequest)
+            return
+        }
+        if err := svc.Transfer.CancelTransfer(r.Context(), id, req); err != nil {
+            log.Error().Err(err).Msg("cancel transfer")
+            writeServiceError(w, err)
+            return
+        }
+        w.WriteHeader(http.StatusOK)
+    }
+}
+
+// ListTransfers godoc
+// @Summary Daftar & pencarian transfer
+// @Description Filter opsional, diurutkan (created_at, id) terbaru dulu. Gunakan next_cursor untuk halaman berikutnya.
+// @Tags Transfers
+// @Produce json
+// @Param status query string false "Status, bisa dipisah koma (pending,accepted)"
+// @Param pallet_id query string false "Pallet ID"
+// @Param from_location query string false "Lokasi asal"
+// @Param to_location query string false "Lokasi tujuan"
+// @Param requested_by query string false "Requester"
+// @Param created_from query string false "created_at >= (RFC3339)"
+// @Param created_to query string false "created_at < (RFC3339)"
+// @Param order query string false "asc atau desc (default desc)"
+// @Param limit query int false "Ukuran halaman (default 50, maks 200)"
+// @Param cursor query string false "next_cursor dari halaman sebelumnya"
+// @Success 200 {object} service.TransferPage
+// @Failure 400 {string} string
+// @Router /transfers [get]
+func listTransfersHandler(svc *service.CombinedService) http.HandlerFunc {
+    return func(w http.ResponseWriter, r *http.Request) {
+        q := r.URL.Query()
+        f := service.TransferFilter{
+            PalletID:     q.Get("pallet_id"),
+            FromLocation: q.Get("from_location"),
+            ToLocation:   q.Get("to_location"),
+            RequestedBy:  q.Get("requested_by"),
+            Ascending:    q.Get("order") == "asc",
+            Cursor:       q.Get("cursor"),
+        }
+        if v := q.Get("status"); v != "" {
+            f.Status = strings.Split(v, ",")
+        }
+        var err error
+        if f.CreatedFrom, err = parseTimeParam(q.Get("created_from")); err != nil {
+            http.Error(w, "invalid created_from", http.StatusBadRequest)
+            return
+        }
+        if f.CreatedTo, err = parseTimeParam(q.Get("created_to")); err != nil {
+            http.Error(w, "invalid created_to", http.StatusBadRequest)
+            return
+        }
+        if v := q.Get("limit"); v != "" {
+            if f.Limit, err = strconv.Atoi(v); err != nil {
+                http.Error(w, "invalid limit", http.StatusBadRequest)
+                return
+            }
+        }
+        page, err := svc.Transfer.ListTransfers(r.Context(), f)
+        if err != nil {
+            log.Error().Err(err).Msg("list transfers")
+            writeServiceError(w, err)
+            return
+        }
+        json.NewEncoder(w).Encode(page)
+    }
+}
+
 // GetTransfer godoc
 // @Summary Mendapatkan detail transfer berdasarkan ID
 // @Tags Transfers
@@ -144,31 +342,618 @@ func ingestTempHandler(svc *service.CombinedService) http.HandlerFunc {
 
 // Get alerts
 // @Summary Get alerts
+// @Description Terbaru lebih dulu. Filter opsional: status (dipisah koma), room_id, rentang created_at (RFC3339).
 // @Tags Temperature
 // @Produce json
+// @Param status query string false "open,acknowledged,resolved"
+// @Param room_id query string false "Room ID"
+// @Param from query string false "created_at >= (RFC3339)"
+// @Param to query string false "created_at < (RFC3339)"
+// @Param limit query int false "Default 100, maks 500"
 // @Success 200 {array} service.Alert
+// @Failure 400 {string} string
 // @Router /alerts [get]
 func getAlertsHandler(svc *service.CombinedService) http.HandlerFunc {
     return func(w http.ResponseWriter, r *http.Request) {
-        alerts, err := svc.Temperature.ListAlerts(r.Context())
+        q := r.URL.Query()
+        f := service.AlertFilter{RoomID: q.Get("room_id")}
+        if v := q.Get("status"); v != "" {
+            f.Status = strings.Split(v, ",")
+        }
+        var err error
+        if f.From, err = parseTimeParam(q.Get("from")); err != nil {
+            http.Error(w, "invalid from", http.StatusBadRequest)
+            return
+        }
+        if f.To, err = parseTimeParam(q.Get("to")); err != nil {
+            http.Error(w, "invalid to", http.StatusBadRequest)
+            return
+        }
+        if v := q.Get("limit"); v != "" {
+            if f.Limit, err = strconv.Atoi(v); err != nil {
+                http.Error(w, "invalid limit", http.StatusBadRequest)
+                return
+            }
+        }
+        alerts, err := svc.Temperature.ListAlerts(r.Context(), f)
         if err != nil {
             log.Error().Err(err).Msg("list alerts")
-            http.Error(w, err.Error(), http.StatusInternalServerError)
+            writeServiceError(w, err)
             return
         }
         json.NewEncoder(w).Encode(alerts)
     }
 }
 
+// GetAlert godoc
+// @Summary Detail alert suhu beserta riwayat acknowledge/resolve
+// @Tags Temperature
+// @Produce json
+// @Param id path string true "Alert ID"
+// @Success 200 {object} service.Alert
+// @Failure 404 {string} string
+// @Router /alerts/{id} [get]
+func getAlertHandler(svc *service.CombinedService) http.HandlerFunc {
+    return func(w http.ResponseWriter, r *http.Request) {
+        a, err := svc.Temperature.GetAlert(r.Context(), chi.URLParam(r, "id"))
+        if err != nil {
+            log.Error().Err(err).Msg("get alert")
+            writeServiceError(w, err)
+            return
+        }
+        json.NewEncoder(w).Encode(a)
+    }
+}
+
+// AckAlert godoc
+// @Summary Acknowledge alert suhu
+// @Description Menandai alert open sebagai acknowledged oleh operator.
+// @Tags Temperature
+// @Accept json
+// @Produce json
+// @Param id path string true "Alert ID"
+// @Param request body service.AcknowledgeAlertRequest true "Acknowledge"
+// @Success 200 {object} service.Alert
+// @Failure 400 {string} string
+// @Failure 404 {string} string
+// @Failure 409 {string} string
+// @Router /alerts/{id}/ack [post]
+func ackAlertHandler(svc *service.CombinedService) http.HandlerFunc {
+    return func(w http.ResponseWriter, r *http.Request) {
+        var req service.AcknowledgeAlertRequest
+        if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+            log.Error().Err(err).Msg("invalid body")
+            http.Error(w, "invalid body", http.StatusBadRequest)
+            return
+        }
+        a, err := svc.Temperature.AcknowledgeAlert(r.Context(), chi.URLParam(r, "id"), req)
+        if err != nil {
+            log.Error().Err(err).Msg("ack alert")
+            writeServiceError(w, err)
+            return
+        }
+        json.NewEncoder(w).Encode(a)
+    }
+}
+
+// ResolveAlert godoc
+// @Summary Resolve alert suhu dengan tindakan korektif
+// @Description corrective_action wajib diisi (catatan HACCP). Alert yang ekskursinya masih aktif ditolak (409) sampai kondisinya clear.
+// @Tags Temperature
+// @Accept json
+// @Produce json
+// @Param id path string true "Alert ID"
+// @Param request body service.ResolveAlertRequest true "Resolve"
+// @Success 200 {object} service.Alert
+// @Failure 400 {string} string
+// @Failure 404 {string} string
+// @Failure 409 {string} string
+// @Router /alerts/{id}/resolve [post]
+func resolveAlertHandler(svc *service.CombinedService) http.HandlerFunc {
+    return func(w http.ResponseWriter, r *http.Request) {
+        var req service.ResolveAlertRequest
+        if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+            log.Error().Err(err).Msg("invalid body")
+            http.Error(w, "invalid body", http.StatusBadRequest)
+            return
+        }
+        a, err := svc.Temperature.ResolveAlert(r.Context(), chi.URLParam(r, "id"), req)
+        if err != nil {
+            log.Error().Err(err).Msg("resolve alert")
+            writeServiceError(w, err)
+            return
+        }
+        json.NewEncoder(w).Encode(a)
+    }
+}
+
+// CreateRoom godoc
+// @Summary Menambah profil suhu cold room
+// @Description Band warning harus berada di dalam band critical: critical_min <= warning_min < warning_max <= critical_max.
+// @Tags Temperature
+// @Accept json
+// @Produce json
+// @Param request body service.RoomRequest true "Room"
+// @Success 201 {object} service.Room
+// @Failure 400 {string} string
+// @Failure 409 {string} string
+// @Router /rooms [post]
+func createRoomHandler(svc *service.CombinedService) http.HandlerFunc {
+    return func(w http.ResponseWriter, r *http.Request) {
+        var req service.RoomRequest
+        if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+            log.Error().Err(err).Msg("invalid body")
+            http.Error(w, "invalid body", http.StatusBadRequest)
+            return
+        }
+        room, err := svc.Room.Create(r.Context(), req)
+        if err != nil {
+            log.Error().Err(err).Msg("create room")
+            writeServiceError(w, err)
+            return
+        }
+        w.WriteHeader(http.StatusCreated)
+        json.NewEncoder(w).Encode(room)
+    }
+}
+
+// ListRooms godoc
+// @Summary Daftar profil suhu cold room
+// @Tags Temperature
+// @Produce json
+// @Success 200 {array} service.Room
+// @Router /rooms [get]
+func listRoomsHandler(svc *service.CombinedService) http.HandlerFunc {
+    return func(w http.ResponseWriter, r *http.Request) {
+        rooms, err := svc.Room.List(r.Context())
+        if err != nil {
+            log.Error().Err(err).Msg("list rooms")
+            writeServiceError(w, err)
+            return
+        }
+        json.NewEncoder(w).Encode(rooms)
+    }
+}
+
+// GetRoom godoc
+// @Summary Detail profil suhu cold room
+// @Tags Temperature
+// @Produce json
+// @Param id path string true "Room ID"
+// @Success 200 {object} service.Room
+// @Failure 404 {string} string
+// @Router /rooms/{id} [get]
+func getRoomHandler(svc *service.CombinedService) http.HandlerFunc {
+    return func(w http.ResponseWriter, r *http.Request) {
+        room, err := svc.Room.Get(r.Context(), chi.URLParam(r, "id"))
+        if err != nil {
+            log.Error().Err(err).Msg("get room")
+            writeServiceError(w, err)
+            return
+        }
+        json.NewEncoder(w).Encode(room)
+    }
+}
+
+// UpdateRoom godoc
+// @Summary Mengubah profil suhu cold room
+// @Description Berlaku untuk pembacaan berikutnya tanpa restart.
+// @Tags Temperature
+// @Accept json
+// @Produce json
+// @Param id path string true "Room ID"
+// @Param request body service.RoomRequest true "Room"
+// @Success 200 {object} service.Room
+// @Failure 400 {string} string
+// @Failure 404 {string} string
+// @Router /rooms/{id} [put]
+func updateRoomHandler(svc *service.CombinedService) http.HandlerFunc {
+    return func(w http.ResponseWriter, r *http.Request) {
+        var req service.RoomRequest
+        if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+            log.Error().Err(err).Msg("invalid body")
+            http.Error(w, "invalid body", http.StatusBadRequest)
+            return
+        }
+        room, err := svc.Room.Update(r.Context(), chi.URLParam(r, "id"), req)
+        if err != nil {
+            log.Error().Err(err).Msg("update room")
+            writeServiceError(w, err)
+            return
+        }
+        json.NewEncoder(w).Encode(room)
+    }
+}
+
+// GetRoomTemperatures godoc
+// @Summary Riwayat suhu ruang, mentah atau per bucket
+// @Description Tanpa bucket mengembalikan pembacaan mentah (maks 10000). Dengan bucket (mis. 30s, 5m, 1h, 1d) mengembalikan min/avg/max/count per bucket. Default rentang 24 jam terakhir.
+// @Tags Temperature
+// @Produce json
+// @Param id path string true "Room ID"
+// @Param from query string false "recorded_at >= (RFC3339)"
+// @Param to query string false "recorded_at < (RFC3339)"
+// @Param bucket query string false "Ukuran bucket"
+// @Success 200 {object} service.TemperatureHistory
+// @Failure 400 {string} string
+// @Router /rooms/{id}/temperatures [get]
+func getRoomTemperaturesHandler(svc *service.CombinedService) http.HandlerFunc {
+    return func(w http.ResponseWriter, r *http.Request) {
+        q := r.URL.Query()
+        hq := service.HistoryQuery{RoomID: chi.URLParam(r, "id")}
+        from, err := parseTimeParam(q.Get("from"))
+        if err != nil {
+            http.Error(w, "invalid from", http.StatusBadRequest)
+            return
+        }
+        to, err := parseTimeParam(q.Get("to"))
+        if err != nil {
+            http.Error(w, "invalid to", http.StatusBadRequest)
+            return
+        }
+        if from != nil { hq.From = *from }
+        if to != nil { hq.To = *to }
+        if hq.Bucket, err = service.ParseBucket(q.Get("bucket")); err != nil {
+            http.Error(w, err.Error(), http.StatusBadRequest)
+            return
+        }
+        h, err := svc.Temperature.History(r.Context(), hq)
+        if err != nil {
+            log.Error().Err(err).Msg("temperature history")
+            writeServiceError(w, err)
+            return
+        }
+        json.NewEncoder(w).Encode(h)
+    }
+}
+
+// FlushOutbox godoc
+// @Summary Kirim semua event outbox yang tertunda sekarang
+// @Description Event dikirim otomatis oleh relay di background; endpoint ini hanya untuk development.
+// @Tags Dev
+// @Produce json
+// @Success 200 {object} map[string]interface{}
+// @Router /dev/flush-outbox [post]
 func flushOutboxHandler(svc *service.CombinedService) http.HandlerFunc {
     return func(w http.ResponseWriter, r *http.Request) {
-        if err := svc.FlushOutbox(r.Context()); err != nil {
+        n, err := svc.FlushOutbox(r.Context())
+        if err != nil {
             log.Error().Err(err).Msg("flush outbox")
             http.Error(w, err.Error(), http.StatusInternalServerError)
             return
         }
         w.WriteHeader(http.StatusOK)
-        json.NewEncoder(w).Encode(map[string]string{"status":"flushed"})
+        json.NewEncoder(w).Encode(map[string]interface{}{"status":"flushed", "published":n})
+    }
+}
+
+// CreateLocation godoc
+// @Summary Menambah master lokasi
+// @Tags Locations
+// @Accept json
+// @Produce json
+// @Param request body service.LocationRequest true "Location"
+// @Success 201 {object} service.Location
+// @Failure 400 {string} string
+// @Failure 409 {string} string
+// @Router /locations [post]
+func createLocationHandler(svc *service.CombinedService) http.HandlerFunc {
+    return func(w http.ResponseWriter, r *http.Request) {
+        var req service.LocationRequest
+        if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+            log.Error().Err(err).Msg("invalid body")
+            http.Error(w, "invalid body", http.StatusBadRequest)
+            return
+        }
+        loc, err := svc.Location.Create(r.Context(), req)
+        if err != nil {
+            log.Error().Err(err).Msg("create location")
+            writeServiceError(w, err)
+            return
+        }
+        w.WriteHeader(http.StatusCreated)
+        json.NewEncoder(w).Encode(loc)
+    }
+}
+
+// ListLocations godoc
+// @Summary Daftar master lokasi
+// @Tags Locations
+// @Produce json
+// @Param active query bool false "Hanya lokasi aktif"
+// @Success 200 {array} service.Location
+// @Router /locations [get]
+func listLocationsHandler(svc *service.CombinedService) http.HandlerFunc {
+    return func(w http.ResponseWriter, r *http.Request) {
+        activeOnly, _ := strconv.ParseBool(r.URL.Query().Get("active"))
+        locs, err := svc.Location.List(r.Context(), activeOnly)
+        if err != nil {
+            log.Error().Err(err).Msg("list locations")
+            writeServiceError(w, err)
+            return
+        }
+        json.NewEncoder(w).Encode(locs)
+    }
+}
+
+// GetLocation godoc
+// @Summary Detail master lokasi
+// @Tags Locations
+// @Produce json
+// @Param code path string true "Location code"
+// @Success 200 {object} service.Location
+// @Failure 404 {string} string
+// @Router /locations/{code} [get]
+func getLocationHandler(svc *service.CombinedService) http.HandlerFunc {
+    return func(w http.ResponseWriter, r *http.Request) {
+        loc, err := svc.Location.Get(r.Context(), chi.URLParam(r, "code"))
+        if err != nil {
+            log.Error().Err(err).Msg("get location")
+            writeServiceError(w, err)
+            return
+        }
+        json.NewEncoder(w).Encode(loc)
+    }
+}
+
+// UpdateLocation godoc
+// @Summary Mengubah master lokasi (zone, room, type, capacity, active)
+// @Tags Locations
+// @Accept json
+// @Produce json
+// @Param code path string true "Location code"
+// @Param request body service.LocationRequest true "Location"
+// @Success 200 {object} service.Location
+// @Failure 400 {string} string
+// @Failure 404 {string} string
+// @Router /locations/{code} [put]
+func updateLocationHandler(svc *service.CombinedService) http.HandlerFunc {
+    return func(w http.ResponseWriter, r *http.Request) {
+        var req service.LocationRequest
+        if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+            log.Error().Err(err).Msg("invalid body")
+            http.Error(w, "invalid body", http.StatusBadRequest)
+            return
+        }
+        loc, err := svc.Location.Update(r.Context(), chi.URLParam(r, "code"), req)
+        if err != nil {
+            log.Error().Err(err).Msg("update location")
+            writeServiceError(w, err)
+            return
+        }
+        json.NewEncoder(w).Encode(loc)
+    }
+}
+
+// DeactivateLocation godoc
+// @Summary Menonaktifkan lokasi
+// @Description Lokasi tidak dihapus, hanya ditandai tidak aktif sehingga tidak bisa dipakai transfer baru.
+// @Tags Locations
+// @Param code path string true "Location code"
+// @Success 204
+// @Failure 404 {string} string
+// @Router /locations/{code} [delete]
+func deactivateLocationHandler(svc *service.CombinedService) http.HandlerFunc {
+    return func(w http.ResponseWriter, r *http.Request) {
+        if err := svc.Location.Deactivate(r.Context(), chi.URLParam(r, "code")); err != nil {
+            log.Error().Err(err).Msg("deactivate location")
+            writeServiceError(w, err)
+            return
+        }
+        w.WriteHeader(http.StatusNoContent)
+    }
+}
+
+// RegisterPallet godoc
+// @Summary Mendaftarkan pallet baru
+// @Tags Pallets
+// @Accept json
+// @Produce json
+// @Param request body service.RegisterPalletRequest true "Pallet"
+// @Success 201 {object} service.Pallet
+// @Failure 400 {string} string
+// @Failure 409 {string} string
+// @Router /pallets [post]
+func registerPalletHandler(svc *service.CombinedService) http.HandlerFunc {
+    return func(w http.ResponseWriter, r *http.Request) {
+        var req service.RegisterPalletRequest
+        if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+            log.Error().Err(err).Msg("invalid body")
+            http.Error(w, "invalid body", http.StatusBadRequest)
+            return
+        }
+        p, err := svc.Pallet.Register(r.Context(), req)
+        if err != nil {
+            log.Error().Err(err).Msg("register pallet")
+            writeServiceError(w, err)
+            return
+        }
+        w.WriteHeader(http.StatusCreated)
+        json.NewEncoder(w).Encode(p)
+    }
+}
+
+// ListPallets godoc
+// @Summary Daftar pallet
+// @Tags Pallets
+// @Produce json
+// @Param location query string false "Filter lokasi saat ini"
+// @Success 200 {array} service.Pallet
+// @Router /pallets [get]
+func listPalletsHandler(svc *service.CombinedService) http.HandlerFunc {
+    return func(w http.ResponseWriter, r *http.Request) {
+        pallets, err := svc.Pallet.List(r.Context(), r.URL.Query().Get("location"))
+        if err != nil {
+            log.Error().Err(err).Msg("list pallets")
+            writeServiceError(w, err)
+            return
+        }
+        json.NewEncoder(w).Encode(pallets)
+    }
+}
+
+// GetPallet godoc
+// @Summary Detail pallet dan lokasi saat ini
+// @Tags Pallets
+// @Produce json
+// @Param sscc path string true "SSCC"
+// @Success 200 {object} service.Pallet
+// @Failure 404 {string} string
+// @Router /pallets/{sscc} [get]
+func getPalletHandler(svc *service.CombinedService) http.HandlerFunc {
+    return func(w http.ResponseWriter, r *http.Request) {
+        p, err := svc.Pallet.Get(r.Context(), chi.URLParam(r, "sscc"))
+        if err != nil {
+            log.Error().Err(err).Msg("get pallet")
+            writeServiceError(w, err)
+            return
+        }
+        json.NewEncoder(w).Encode(p)
+    }
+}
+
+// GetLocationInventory godoc
+// @Summary Stok pallet on-hand per lokasi
+// @Description Read model yang diproyeksikan dari event transfer.completed.
+// @Tags Inventory
+// @Produce json
+// @Param id path string true "Location ID"
+// @Success 200 {object} service.LocationInventory
+// @Failure 404 {string} string
+// @Router /inventory/locations/{id} [get]
+func getLocationInventoryHandler(svc *service.CombinedService) http.HandlerFunc {
+    return func(w http.ResponseWriter, r *http.Request) {
+        id := chi.URLParam(r, "id")
+        inv, err := svc.Inventory.GetLocation(r.Context(), id)
+        if err != nil {
+            log.Error().Err(err).Msg("get location inventory")
+            writeServiceError(w, err)
+            return
+        }
+        json.NewEncoder(w).Encode(inv)
+    }
+}
+
+// GetPalletInventory godoc
+// @Summary Lokasi terkini sebuah pallet
+// @Tags Inventory
+// @Produce json
+// @Param id path string true "Pallet ID"
+// @Success 200 {object} service.PalletInventory
+// @Failure 404 {string} string
+// @Router /inventory/pallets/{id} [get]
+func getPalletInventoryHandler(svc *service.CombinedService) http.HandlerFunc {
+    return func(w http.ResponseWriter, r *http.Request) {
+        id := chi.URLParam(r, "id")
+        p, err := svc.Inventory.GetPallet(r.Context(), id)
+        if err != nil {
+            log.Error().Err(err).Msg("get pallet inventory")
+            writeServiceError(w, err)
+            return
+        }
+        json.NewEncoder(w).Encode(p)
+    }
+}
+
+// GetRoomAlertStats godoc
+// @Summary Jumlah alert per ruang dan level
+// @Tags Stats
+// @Produce json
+// @Success 200 {array} service.RoomAlertCount
+// @Router /stats/rooms/alerts [get]
+func getRoomAlertStatsHandler(svc *service.CombinedService) http.HandlerFunc {
+    return func(w http.ResponseWriter, r *http.Request) {
+        res, err := svc.Stats.RoomAlertCounts(r.Context())
+        if err != nil {
+            log.Error().Err(err).Msg("room alert stats")
+            http.Error(w, err.Error(), http.StatusInternalServerError)
+            return
+        }
+        json.NewEncoder(w).Encode(res)
+    }
+}
+
+// GetOperatorStats godoc
+// @Summary Statistik pemindahan per operator
+// @Description Jumlah transfer selesai, rata-rata durasi pemindahan dan dwell time (accept → complete).
+// @Tags Stats
+// @Produce json
+// @Success 200 {array} service.OperatorStats
+// @Router /stats/operators [get]
+func getOperatorStatsHandler(svc *service.CombinedService) http.HandlerFunc {
+    return func(w http.ResponseWriter, r *http.Request) {
+        res, err := svc.Stats.OperatorStats(r.Context())
+        if err != nil {
+            log.Error().Err(err).Msg("operator stats")
+            http.Error(w, err.Error(), http.StatusInternalServerError)
+            return
+        }
+        json.NewEncoder(w).Encode(res)
+    }
+}
+
+// ListDeadLetters godoc
+// @Summary Daftar event outbox yang masuk dead-letter
+// @Tags Admin
+// @Produce json
+// @Param limit query int false "Maksimum jumlah event (default 100)"
+// @Success 200 {array} service.OutboxEvent
+// @Router /admin/outbox/dead-letters [get]
+func listDeadLettersHandler(svc *service.CombinedService) http.HandlerFunc {
+    return func(w http.ResponseWriter, r *http.Request) {
+        limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+        events, err := svc.Relay.ListDeadLetters(r.Context(), limit)
+        if err != nil {
+            log.Error().Err(err).Msg("list dead letters")
+            http.Error(w, err.Error(), http.StatusInternalServerError)
+            return
+        }
+        json.NewEncoder(w).Encode(events)
+    }
+}
+
+// RequeueDeadLetter godoc
+// @Summary Kirim ulang event dead-letter
+// @Description Reset jumlah percobaan sehingga relay mencoba mengirim event lagi.
+// @Tags Admin
+// @Param id path string true "Outbox Event ID"
+// @Success 200
+// @Failure 404 {string} string
+// @Router /admin/outbox/dead-letters/{id}/requeue [post]
+func requeueDeadLetterHandler(svc *service.CombinedService) http.HandlerFunc {
+    return func(w http.ResponseWriter, r *http.Request) {
+        id := chi.URLParam(r, "id")
+        if err := svc.Relay.Requeue(r.Context(), id); err != nil {
+            log.Error().Err(err).Msg("requeue dead letter")
+            writeServiceError(w, err)
+            return
+        }
+        w.WriteHeader(http.StatusOK)
+    }
+}
+
+// parseTimeParam parses an optional RFC3339 query parameter.
+func parseTimeParam(v string) (*time.Time, error) {
+    if v == "" { return nil, nil }
+    t, err := time.Parse(time.RFC3339, v)
+    if err != nil { return nil, err }
+    return &t, nil
+}
+
+// writeServiceError maps service errors to HTTP status codes.
+func writeServiceError(w http.ResponseWriter, err error) {
+    var te *service.TransitionError
+    switch {
+    case errors.Is(err, service.ErrNotFound):
+        http.Error(w, err.Error(), http.StatusNotFound)
+    case errors.Is(err, service.ErrInvalidRequest):
+        http.Error(w, err.Error(), http.StatusBadRequest)
+    case errors.Is(err, service.ErrForbidden):
+        http.Error(w, err.Error(), http.StatusForbidden)
+    case errors.As(err, &te), errors.Is(err, service.ErrStaleStatus), errors.Is(err, service.ErrConflict), errors.Is(err, service.ErrCapacityExceeded), errors.Is(err, service.ErrDuplicateRequest):
+        http.Error(w, err.Error(), http.StatusConflict)
+    default:
+        http.Error(w, err.Error(), http.StatusInternalServerError)
     }
 }
 
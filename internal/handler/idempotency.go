@@ -0,0 +1,88 @@
+package handler
+
+import (
+    "bytes"
+    "context"
+    "errors"
+    "io"
+    "net/http"
+
+    "github.com/rs/zerolog/log"
+    "transfer-service/internal/service"
+)
+
+// responseRecorder tees the response to the client while keeping a copy for
+// the idempotency store.
+type responseRecorder struct {
+    http.ResponseWriter
+    status int
+    body   bytes.Buffer
+}
+
+func (rr *responseRecorder) WriteHeader(code int) {
+    rr.status = code
+    rr.ResponseWriter.WriteHeader(code)
+}
+
+func (rr *responseRecorder) Write(b []byte) (int, error) {
+    if rr.status == 0 { rr.status = http.StatusOK }
+    rr.body.Write(b)
+    return rr.ResponseWriter.Write(b)
+}
+
+// Idempotent replays the stored response for requests that repeat an
+// Idempotency-Key with the same method, path and body. Reusing a key for a
+// different request yields 422. Requests without the header pass through.
+func Idempotent(svc *service.CombinedService) func(http.Handler) http.Handler {
+    return func(next http.Handler) http.Handler {
+        return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+            key := r.Header.Get("Idempotency-Key")
+            if key == "" {
+                next.ServeHTTP(w, r)
+                return
+            }
+            body, err := io.ReadAll(r.Body)
+            if err != nil {
+                http.Error(w, "invalid body", http.StatusBadRequest)
+                return
+            }
+            r.Body = io.NopCloser(bytes.NewReader(body))
+
+            rec, token, err := svc.Idempotency.Begin(r.Context(), key, service.HashRequest(r.Method, r.URL.Path, body))
+            switch {
+            case errors.Is(err, service.ErrIdempotencyMismatch):
+                http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+                return
+            case errors.Is(err, service.ErrIdempotencyInProgress):
+                http.Error(w, err.Error(), http.StatusConflict)
+                return
+            case err != nil:
+                log.Error().Err(err).Msg("idempotency lookup")
+                http.Error(w, err.Error(), http.StatusInternalServerError)
+                return
+            case rec != nil:
+                w.Header().Set("Idempotent-Replayed", "true")
+                w.WriteHeader(rec.StatusCode)
+                w.Write(rec.ResponseBody)
+                return
+            }
+
+            rr := &responseRecorder{ResponseWriter: w}
+            next.ServeHTTP(rr, r)
+            if rr.status == 0 { rr.status = http.StatusOK }
+            // The request context is cancelled once the client goes away;
+            // the reservation must still be settled.
+            ctx := context.WithoutCancel(r.Context())
+            // Server errors are not cached so the client can retry them.
+            if rr.status >= http.StatusInternalServerError {
+                if err := svc.Idempotency.Abort(ctx, key, token); err != nil {
+                    log.Error().Err(err).Str("key", key).Msg("release idempotency key")
+                }
+                return
+            }
+            if err := svc.Idempotency.Complete(ctx, key, token, rr.status, rr.body.Bytes()); err != nil {
+                log.Error().Err(err).Str("key", key).Msg("store idempotent response")
+            }
+        })
+    }
+}
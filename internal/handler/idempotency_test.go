@@ -0,0 +1,111 @@
+package handler
+
+import (
+    "context"
+    "net/http"
+    "net/http/httptest"
+    "strings"
+    "sync"
+    "testing"
+    "time"
+
+    "transfer-service/internal/service"
+)
+
+// memIdempotencyRepo keeps idempotency records in memory. Other Repo methods
+// are not used by the middleware.
+type memIdempotencyRepo struct {
+    service.Repo
+    mu      sync.Mutex
+    records map[string]*service.IdempotencyRecord
+    tokens  map[string]string
+}
+
+func newMemIdempotencyRepo() *memIdempotencyRepo {
+    return &memIdempotencyRepo{records: map[string]*service.IdempotencyRecord{}, tokens: map[string]string{}}
+}
+
+func (m *memIdempotencyRepo) ReserveIdempotencyKey(ctx context.Context, key, requestHash, token string, now, leaseExpiresAt, expiresAt time.Time) (*service.IdempotencyRecord, bool, error) {
+    m.mu.Lock()
+    defer m.mu.Unlock()
+    if rec, ok := m.records[key]; ok && !rec.ExpiresAt.Before(now) {
+        if !(rec.StatusCode == 0 && rec.LeaseExpiresAt.Before(now) && rec.RequestHash == requestHash) {
+            cp := *rec
+            return &cp, false, nil
+        }
+    }
+    m.records[key] = &service.IdempotencyRecord{Key: key, RequestHash: requestHash, CreatedAt: now, ExpiresAt: expiresAt, LeaseExpiresAt: leaseExpiresAt}
+    m.tokens[key] = token
+    return nil, true, nil
+}
+
+func (m *memIdempotencyRepo) SaveIdempotencyResponse(ctx context.Context, key, token string, statusCode int, body []byte) error {
+    m.mu.Lock()
+    defer m.mu.Unlock()
+    rec, ok := m.records[key]
+    if !ok || m.tokens[key] != token || rec.StatusCode != 0 { return service.ErrIdempotencyLeaseLost }
+    rec.StatusCode, rec.ResponseBody = statusCode, append([]byte(nil), body...)
+    return nil
+}
+
+func (m *memIdempotencyRepo) DeleteIdempotencyKey(ctx context.Context, key, token string) error {
+    m.mu.Lock()
+    defer m.mu.Unlock()
+    if rec, ok := m.records[key]; ok && m.tokens[key] == token && rec.StatusCode == 0 { delete(m.records, key) }
+    return nil
+}
+
+func idempotentServer(repo service.Repo, calls *int) http.Handler {
+    svc := &service.CombinedService{Idempotency: service.NewIdempotencyService(repo)}
+    return Idempotent(svc)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        *calls++
+        w.WriteHeader(http.StatusCreated)
+        w.Write([]byte(`{"id":"t1"}`))
+    }))
+}
+
+func postTransfer(h http.Handler, key, body string) *httptest.ResponseRecorder {
+    req := httptest.NewRequest(http.MethodPost, "/api/transfers", strings.NewReader(body))
+    req.Header.Set("Idempotency-Key", key)
+    rec := httptest.NewRecorder()
+    h.ServeHTTP(rec, req)
+    return rec
+}
+
+func TestIdempotentReplaysStoredResponse(t *testing.T) {
+    calls := 0
+    h := idempotentServer(newMemIdempotencyRepo(), &calls)
+    body := `{"pallet_id":"P1"}`
+
+    first := postTransfer(h, "k1", body)
+    if first.Code != http.StatusCreated || first.Header().Get("Idempotent-Replayed") != "" {
+        t.Fatalf("first request: %d replayed=%q", first.Code, first.Header().Get("Idempotent-Replayed"))
+    }
+    second := postTransfer(h, "k1", body)
+    if second.Code != http.StatusCreated || second.Body.String() != first.Body.String() {
+        t.Fatalf("replay: %d %q, want %d %q", second.Code, second.Body.String(), first.Code, first.Body.String())
+    }
+    if second.Header().Get("Idempotent-Replayed") != "true" { t.Fatal("replay is missing Idempotent-Replayed: true") }
+    if calls != 1 { t.Fatalf("handler ran %d times, want 1", calls) }
+}
+
+func TestIdempotentRejectsKeyReuseWithDifferentBody(t *testing.T) {
+    calls := 0
+    h := idempotentServer(newMemIdempotencyRepo(), &calls)
+    postTransfer(h, "k1", `{"pallet_id":"P1"}`)
+    rec := postTransfer(h, "k1", `{"pallet_id":"P2"}`)
+    if rec.Code != http.StatusUnprocessableEntity { t.Fatalf("different body: %d, want 422", rec.Code) }
+    if calls != 1 { t.Fatalf("handler ran %d times, want 1", calls) }
+}
+
+func TestIdempotentRejectsKeyInFlight(t *testing.T) {
+    repo := newMemIdempotencyRepo()
+    body := `{"pallet_id":"P1"}`
+    now := time.Now().UTC()
+    repo.records["k1"] = &service.IdempotencyRecord{Key: "k1", RequestHash: service.HashRequest(http.MethodPost, "/api/transfers", []byte(body)),
+        CreatedAt: now, ExpiresAt: now.Add(time.Hour), LeaseExpiresAt: now.Add(time.Minute)}
+    calls := 0
+    rec := postTransfer(idempotentServer(repo, &calls), "k1", body)
+    if rec.Code != http.StatusConflict { t.Fatalf("in-flight key: %d, want 409", rec.Code) }
+    if calls != 0 { t.Fatalf("handler ran %d times, want 0", calls) }
+}
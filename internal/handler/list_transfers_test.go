@@ -0,0 +1,124 @@
+package handler
+
+import (
+    "context"
+    "encoding/base64"
+    "encoding/json"
+    "fmt"
+    "net/http"
+    "net/http/httptest"
+    "net/url"
+    "sort"
+    "testing"
+    "time"
+
+    "transfer-service/internal/service"
+)
+
+// keysetRepo pages an in-memory transfer list the way the Postgres query
+// does: ordered by (created_at, id) and strictly after the cursor. Other Repo
+// methods are not used by the handler.
+type keysetRepo struct {
+    service.Repo
+    transfers []service.Transfer
+}
+
+func (r *keysetRepo) ListTransfers(ctx context.Context, f service.TransferFilter, after *service.TransferCursor, limit int) ([]service.Transfer, error) {
+    less := func(a, b service.Transfer) bool {
+        if !a.CreatedAt.Equal(b.CreatedAt) { return a.CreatedAt.Before(b.CreatedAt) }
+        return a.ID < b.ID
+    }
+    items := append([]service.Transfer(nil), r.transfers...)
+    sort.Slice(items, func(i, j int) bool {
+        if f.Ascending { return less(items[i], items[j]) }
+        return less(items[j], items[i])
+    })
+    var out []service.Transfer
+    for _, t := range items {
+        if after != nil {
+            pos := service.Transfer{ID: after.ID, CreatedAt: after.CreatedAt}
+            if f.Ascending && !less(pos, t) || !f.Ascending && !less(t, pos) { continue }
+        }
+        if len(out) == limit { break }
+        out = append(out, t)
+    }
+    return out, nil
+}
+
+func newKeysetRepo() *keysetRepo {
+    base := time.Date(2026, 5, 4, 9, 0, 0, 123456789, time.UTC)
+    r := &keysetRepo{}
+    for i := 0; i < 7; i++ {
+        // Pairs share a timestamp so the id tiebreak is exercised.
+        r.transfers = append(r.transfers, service.Transfer{ID: fmt.Sprintf("t%d", i), CreatedAt: base.Add(time.Duration(i/2) * time.Millisecond)})
+    }
+    return r
+}
+
+func listTransfers(repo service.Repo, query url.Values) *httptest.ResponseRecorder {
+    svc := &service.CombinedService{Transfer: service.NewTransferService(repo)}
+    req := httptest.NewRequest(http.MethodGet, "/api/transfers?"+query.Encode(), nil)
+    rec := httptest.NewRecorder()
+    listTransfersHandler(svc)(rec, req)
+    return rec
+}
+
+func TestListTransfersCursorRoundTrip(t *testing.T) {
+    repo := newKeysetRepo()
+    for _, order := range []string{"asc", "desc"} {
+        t.Run(order, func(t *testing.T) {
+            var seen []string
+            query := url.Values{"order": {order}, "limit": {"2"}}
+            for pages := 0; ; pages++ {
+                if pages > len(repo.transfers) { t.Fatal("pagination did not terminate") }
+                rec := listTransfers(repo, query)
+                if rec.Code != http.StatusOK { t.Fatalf("page %d: %d %s", pages, rec.Code, rec.Body.String()) }
+                var page service.TransferPage
+                if err := json.Unmarshal(rec.Body.Bytes(), &page); err != nil { t.Fatal(err) }
+                for _, tr := range page.Items { seen = append(seen, tr.ID) }
+                if page.NextCursor == "" { break }
+                query.Set("cursor", page.NextCursor)
+            }
+            want := "[t0 t1 t2 t3 t4 t5 t6]"
+            if order == "desc" { want = "[t6 t5 t4 t3 t2 t1 t0]" }
+            if got := fmt.Sprint(seen); got != want { t.Fatalf("paged %s, want %s", got, want) }
+        })
+    }
+}
+
+func TestTransferCursorEncodeDecode(t *testing.T) {
+    for _, asc := range []bool{true, false} {
+        in := service.TransferCursor{CreatedAt: time.Date(2026, 5, 4, 9, 0, 0, 1, time.UTC), ID: "a|b", Ascending: asc}
+        out, err := service.DecodeTransferCursor(service.EncodeTransferCursor(in))
+        if err != nil { t.Fatal(err) }
+        if !out.CreatedAt.Equal(in.CreatedAt) || out.ID != in.ID || out.Ascending != in.Ascending {
+            t.Fatalf("round trip = %+v, want %+v", *out, in)
+        }
+    }
+}
+
+func TestListTransfersRejectsBadCursor(t *testing.T) {
+    enc := func(s string) string { return base64.RawURLEncoding.EncodeToString([]byte(s)) }
+    for name, cursor := range map[string]string{
+        "not base64":    "!!!",
+        "no separator":  enc("garbage"),
+        "old format":    enc("2026-05-04T09:00:00Z|t1"),
+        "unknown order": enc("up|2026-05-04T09:00:00Z|t1"),
+        "bad timestamp": enc("asc|yesterday|t1"),
+        "empty id":      enc("asc|2026-05-04T09:00:00Z|"),
+    } {
+        rec := listTransfers(newKeysetRepo(), url.Values{"cursor": {cursor}})
+        if rec.Code != http.StatusBadRequest { t.Errorf("%s: %d, want 400", name, rec.Code) }
+    }
+}
+
+func TestListTransfersRejectsCursorFromOtherOrder(t *testing.T) {
+    repo := newKeysetRepo()
+    rec := listTransfers(repo, url.Values{"order": {"asc"}, "limit": {"2"}})
+    var page service.TransferPage
+    if err := json.Unmarshal(rec.Body.Bytes(), &page); err != nil || page.NextCursor == "" {
+        t.Fatalf("first page: %d %s", rec.Code, rec.Body.String())
+    }
+    rec = listTransfers(repo, url.Values{"order": {"desc"}, "cursor": {page.NextCursor}})
+    if rec.Code != http.StatusBadRequest { t.Fatalf("desc with an asc cursor: %d, want 400", rec.Code) }
+}
@@ -0,0 +1,54 @@
+package publisher
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"transfer-service/internal/service"
+)
+
+const cloudEventsSpecVersion = "1.0"
+
+// CloudEvent is the CloudEvents 1.0 structured-mode JSON envelope.
+type CloudEvent struct {
+	SpecVersion     string          `json:"specversion"`
+	ID              string          `json:"id"`
+	Source          string          `json:"source"`
+	Type            string          `json:"type"`
+	Subject         string          `json:"subject,omitempty"`
+	Time            time.Time       `json:"time"`
+	DataContentType string          `json:"datacontenttype"`
+	Data            json.RawMessage `json:"data"`
+}
+
+// NewCloudEvent wraps an outbox row. The outbox ID becomes the event ID, so
+// redeliveries carry the same ID and consumers can dedupe on it. source is
+// suffixed with the aggregate type, e.g. /transfer-service/transfer.
+func NewCloudEvent(ev service.OutboxEvent, source string) CloudEvent {
+	return CloudEvent{
+		SpecVersion:     cloudEventsSpecVersion,
+		ID:              ev.ID,
+		Source:          strings.TrimRight(source, "/") + "/" + ev.AggregateType,
+		Type:            ev.Topic,
+		Subject:         ev.AggregateID,
+		Time:            ev.CreatedAt.UTC(),
+		DataContentType: "application/json",
+		Data:            json.RawMessage(ev.Payload),
+	}
+}
+
+// SetBinaryHeaders maps the envelope attributes to ce-* headers for the
+// CloudEvents HTTP binary content mode; the request body is the data alone.
+func (ce CloudEvent) SetBinaryHeaders(h http.Header) {
+	h.Set("ce-specversion", ce.SpecVersion)
+	h.Set("ce-id", ce.ID)
+	h.Set("ce-source", ce.Source)
+	h.Set("ce-type", ce.Type)
+	if ce.Subject != "" {
+		h.Set("ce-subject", ce.Subject)
+	}
+	h.Set("ce-time", ce.Time.Format(time.RFC3339Nano))
+	h.Set("Content-Type", ce.DataContentType)
+}
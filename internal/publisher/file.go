@@ -0,0 +1,42 @@
+package publisher
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/rs/zerolog/log"
+
+	"transfer-service/internal/service"
+)
+
+// FilePublisher writes each event as a structured CloudEvent to its own JSON
+// file in Dir, named <topic>_<id>.json.
+type FilePublisher struct {
+	Dir    string
+	Source string
+}
+
+func NewFilePublisher(dir, source string) *FilePublisher {
+	return &FilePublisher{Dir: dir, Source: source}
+}
+
+func (p *FilePublisher) Publish(ctx context.Context, events []service.OutboxEvent) error {
+	if err := os.MkdirAll(p.Dir, 0o755); err != nil {
+		return err
+	}
+	for _, ev := range events {
+		b, err := json.MarshalIndent(NewCloudEvent(ev, p.Source), "", "  ")
+		if err != nil {
+			return err
+		}
+		path := filepath.Join(p.Dir, fmt.Sprintf("%s_%s.json", ev.Topic, ev.ID))
+		if err := os.WriteFile(path, b, 0o644); err != nil {
+			return err
+		}
+		log.Info().Str("outbox_file", path).Msg("wrote outbox event")
+	}
+	return nil
+}
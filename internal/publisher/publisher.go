@@ -0,0 +1,124 @@
+package publisher
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"transfer-service/internal/service"
+)
+
+// FromEnv builds the publisher named by OUTBOX_PUBLISHER. Several sinks can
+// be combined with commas, e.g. "file,webhook". Defaults to the file sink.
+// Each sink can be limited to some topics with OUTBOX_<SINK>_TOPICS, e.g.
+// OUTBOX_WEBHOOK_TOPICS=transfer.completed. Every sink emits CloudEvents
+// with the source taken from EVENT_SOURCE.
+func FromEnv() (service.Publisher, error) {
+	names := os.Getenv("OUTBOX_PUBLISHER")
+	if names == "" {
+		names = "file"
+	}
+	source := os.Getenv("EVENT_SOURCE")
+	if source == "" {
+		source = "/transfer-service"
+	}
+	var pubs []service.Publisher
+	for _, name := range strings.Split(names, ",") {
+		name = strings.TrimSpace(name)
+		var p service.Publisher
+		switch name {
+		case "file":
+			dir := os.Getenv("OUTBOX_DIR")
+			if dir == "" {
+				dir = "outbox_events"
+			}
+			p = NewFilePublisher(dir, source)
+		case "stdout":
+			p = NewStdoutPublisher(os.Stdout, source)
+		case "webhook":
+			url := os.Getenv("OUTBOX_WEBHOOK_URL")
+			if url == "" {
+				return nil, fmt.Errorf("OUTBOX_WEBHOOK_URL is required for the webhook publisher")
+			}
+			timeout := 10 * time.Second
+			if v := os.Getenv("OUTBOX_WEBHOOK_TIMEOUT"); v != "" {
+				d, err := time.ParseDuration(v)
+				if err != nil || d <= 0 {
+					return nil, fmt.Errorf("OUTBOX_WEBHOOK_TIMEOUT must be a positive duration, got %q", v)
+				}
+				timeout = d
+			}
+			p = NewWebhookPublisher(url, source, os.Getenv("OUTBOX_WEBHOOK_MODE"), timeout)
+		case "":
+			continue
+		default:
+			return nil, fmt.Errorf("unknown outbox publisher %q", name)
+		}
+		if topics := os.Getenv("OUTBOX_" + strings.ToUpper(name) + "_TOPICS"); topics != "" {
+			p = Filter(p, strings.Split(topics, ","))
+		}
+		pubs = append(pubs, p)
+	}
+	if len(pubs) == 1 {
+		return pubs[0], nil
+	}
+	return Multi(pubs), nil
+}
+
+// Multi fans a batch out to every publisher in order and stops at the first
+// failure, so the relay retries the whole batch.
+type Multi []service.Publisher
+
+func (m Multi) Publish(ctx context.Context, events []service.OutboxEvent) error {
+	for _, p := range m {
+		if err := p.Publish(ctx, events); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// TopicFilter forwards only events whose topic matches one of Topics. A
+// pattern ending in ".*" matches every topic under that prefix, so
+// "transfer.*" covers transfer.created and transfer.completed.
+type TopicFilter struct {
+	Next   service.Publisher
+	Topics []string
+}
+
+func Filter(next service.Publisher, topics []string) *TopicFilter {
+	var clean []string
+	for _, t := range topics {
+		if t = strings.TrimSpace(t); t != "" {
+			clean = append(clean, t)
+		}
+	}
+	return &TopicFilter{Next: next, Topics: clean}
+}
+
+func (f *TopicFilter) Publish(ctx context.Context, events []service.OutboxEvent) error {
+	var matched []service.OutboxEvent
+	for _, ev := range events {
+		if f.Match(ev.Topic) {
+			matched = append(matched, ev)
+		}
+	}
+	if len(matched) == 0 {
+		return nil
+	}
+	return f.Next.Publish(ctx, matched)
+}
+
+func (f *TopicFilter) Match(topic string) bool {
+	for _, pattern := range f.Topics {
+		if pattern == "*" || pattern == topic {
+			return true
+		}
+		if strings.HasSuffix(pattern, ".*") && strings.HasPrefix(topic, strings.TrimSuffix(pattern, "*")) {
+			return true
+		}
+	}
+	return false
+}
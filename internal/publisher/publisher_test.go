@@ -0,0 +1,69 @@
+package publisher
+
+import (
+	"context"
+	"testing"
+
+	"transfer-service/internal/service"
+)
+
+type recordingPublisher struct {
+	events []service.OutboxEvent
+}
+
+func (r *recordingPublisher) Publish(ctx context.Context, events []service.OutboxEvent) error {
+	r.events = append(r.events, events...)
+	return nil
+}
+
+func TestTopicFilterMatch(t *testing.T) {
+	tests := []struct {
+		name    string
+		pattern string
+		topic   string
+		want    bool
+	}{
+		{"exact", "transfer.created", "transfer.created", true},
+		{"exact other topic", "transfer.created", "transfer.completed", false},
+		{"exact is not a prefix", "transfer", "transfer.created", false},
+		{"catch-all", "*", "pallet.moved", true},
+		{"prefix wildcard", "transfer.*", "transfer.completed", true},
+		{"prefix wildcard nested", "transfer.*", "transfer.status.changed", true},
+		{"prefix wildcard other aggregate", "transfer.*", "pallet.moved", false},
+		{"prefix wildcard needs the dot", "transfer.*", "transfers.created", false},
+		{"prefix wildcard without suffix", "transfer.*", "transfer", false},
+		{"star inside pattern is literal", "transfer*", "transfer.created", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := Filter(nil, []string{tt.pattern})
+			if got := f.Match(tt.topic); got != tt.want {
+				t.Fatalf("Match(%q) with %q = %v, want %v", tt.topic, tt.pattern, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTopicFilterForwardsOnlyMatchingEvents(t *testing.T) {
+	next := &recordingPublisher{}
+	f := Filter(next, []string{" pallet.moved ", "", "alert.*"})
+	events := []service.OutboxEvent{
+		{ID: "1", Topic: "transfer.created"},
+		{ID: "2", Topic: "pallet.moved"},
+		{ID: "3", Topic: "alert.raised"},
+	}
+	if err := f.Publish(context.Background(), events); err != nil {
+		t.Fatal(err)
+	}
+	if len(next.events) != 2 || next.events[0].ID != "2" || next.events[1].ID != "3" {
+		t.Fatalf("forwarded %+v, want events 2 and 3", next.events)
+	}
+
+	next.events = nil
+	if err := f.Publish(context.Background(), events[:1]); err != nil {
+		t.Fatal(err)
+	}
+	if next.events != nil {
+		t.Fatalf("forwarded %+v for a batch with no matching topic", next.events)
+	}
+}
@@ -0,0 +1,33 @@
+package publisher
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"sync"
+
+	"transfer-service/internal/service"
+)
+
+// StdoutPublisher writes one structured CloudEvent per line (NDJSON) to W.
+type StdoutPublisher struct {
+	mu     sync.Mutex
+	W      io.Writer
+	Source string
+}
+
+func NewStdoutPublisher(w io.Writer, source string) *StdoutPublisher {
+	return &StdoutPublisher{W: w, Source: source}
+}
+
+func (p *StdoutPublisher) Publish(ctx context.Context, events []service.OutboxEvent) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	enc := json.NewEncoder(p.W)
+	for _, ev := range events {
+		if err := enc.Encode(NewCloudEvent(ev, p.Source)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
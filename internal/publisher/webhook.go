@@ -0,0 +1,77 @@
+package publisher
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"transfer-service/internal/service"
+)
+
+// Webhook content modes, see the CloudEvents HTTP protocol binding.
+const (
+	ModeStructured = "structured"
+	ModeBinary     = "binary"
+)
+
+// WebhookPublisher POSTs each event to URL as a CloudEvent, either as a
+// structured JSON envelope or in binary mode (ce-* headers, data as body).
+// Any non-2xx response fails the event.
+type WebhookPublisher struct {
+	URL    string
+	Source string
+	Mode   string
+	Client *http.Client
+}
+
+func NewWebhookPublisher(url, source, mode string, timeout time.Duration) *WebhookPublisher {
+	if mode != ModeBinary {
+		mode = ModeStructured
+	}
+	return &WebhookPublisher{URL: url, Source: source, Mode: mode, Client: &http.Client{Timeout: timeout}}
+}
+
+func (p *WebhookPublisher) Publish(ctx context.Context, events []service.OutboxEvent) error {
+	for _, ev := range events {
+		if err := p.send(ctx, NewCloudEvent(ev, p.Source)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *WebhookPublisher) send(ctx context.Context, ce CloudEvent) error {
+	var body []byte
+	if p.Mode == ModeBinary {
+		body = ce.Data
+	} else {
+		b, err := json.Marshal(ce)
+		if err != nil {
+			return err
+		}
+		body = b
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	if p.Mode == ModeBinary {
+		ce.SetBinaryHeaders(req.Header)
+	} else {
+		req.Header.Set("Content-Type", "application/cloudevents+json")
+	}
+	resp, err := p.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook %s returned %d for event %s", p.URL, resp.StatusCode, ce.ID)
+	}
+	return nil
+}
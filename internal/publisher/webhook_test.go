@@ -0,0 +1,134 @@
+package publisher
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"transfer-service/internal/service"
+)
+
+var testEvent = service.OutboxEvent{
+	ID:            "8f0c2a8e-4c1b-4a4e-9a57-2f6c9d1e7b10",
+	AggregateType: "transfer",
+	AggregateID:   "tr-1",
+	Topic:         "transfer.created",
+	Payload:       `{"transfer_id":"tr-1","pallet_id":"P-1"}`,
+	CreatedAt:     time.Date(2026, 3, 1, 8, 30, 0, 0, time.FixedZone("WIB", 7*3600)),
+}
+
+type capturedRequest struct {
+	header http.Header
+	body   []byte
+}
+
+func webhookServer(t *testing.T, status int) (*httptest.Server, *capturedRequest) {
+	t.Helper()
+	got := &capturedRequest{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got.header = r.Header.Clone()
+		got.body, _ = io.ReadAll(r.Body)
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(srv.Close)
+	return srv, got
+}
+
+func TestWebhookStructuredMode(t *testing.T) {
+	srv, got := webhookServer(t, http.StatusAccepted)
+	p := NewWebhookPublisher(srv.URL, "/transfer-service/", "", time.Second)
+	if err := p.Publish(context.Background(), []service.OutboxEvent{testEvent}); err != nil {
+		t.Fatal(err)
+	}
+	if ct := got.header.Get("Content-Type"); ct != "application/cloudevents+json" {
+		t.Fatalf("Content-Type = %q", ct)
+	}
+	if h := got.header.Get("ce-id"); h != "" {
+		t.Fatalf("structured mode sent ce-id header %q", h)
+	}
+
+	var env map[string]json.RawMessage
+	if err := json.Unmarshal(got.body, &env); err != nil {
+		t.Fatalf("body is not a JSON envelope: %v", err)
+	}
+	want := map[string]string{
+		"specversion":     "1.0",
+		"id":              testEvent.ID,
+		"source":          "/transfer-service/transfer",
+		"type":            "transfer.created",
+		"subject":         "tr-1",
+		"time":            "2026-03-01T01:30:00Z",
+		"datacontenttype": "application/json",
+	}
+	for attr, v := range want {
+		var s string
+		if err := json.Unmarshal(env[attr], &s); err != nil || s != v {
+			t.Errorf("%s = %s, want %q", attr, env[attr], v)
+		}
+	}
+	var data, payload any
+	json.Unmarshal(env["data"], &data)
+	json.Unmarshal([]byte(testEvent.Payload), &payload)
+	if b1, b2 := mustJSON(t, data), mustJSON(t, payload); b1 != b2 {
+		t.Fatalf("data = %s, want %s", b1, b2)
+	}
+}
+
+func TestWebhookBinaryMode(t *testing.T) {
+	srv, got := webhookServer(t, http.StatusOK)
+	p := NewWebhookPublisher(srv.URL, "/transfer-service", ModeBinary, time.Second)
+	if err := p.Publish(context.Background(), []service.OutboxEvent{testEvent}); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{
+		"ce-specversion": "1.0",
+		"ce-id":          testEvent.ID,
+		"ce-source":      "/transfer-service/transfer",
+		"ce-type":        "transfer.created",
+		"ce-subject":     "tr-1",
+		"ce-time":        "2026-03-01T01:30:00Z",
+		"Content-Type":   "application/json",
+	}
+	for h, v := range want {
+		if got := got.header.Get(h); got != v {
+			t.Errorf("%s = %q, want %q", h, got, v)
+		}
+	}
+	if string(got.body) != testEvent.Payload {
+		t.Fatalf("body = %s, want the bare payload %s", got.body, testEvent.Payload)
+	}
+}
+
+func TestWebhookBinaryModeOmitsEmptySubject(t *testing.T) {
+	srv, got := webhookServer(t, http.StatusOK)
+	p := NewWebhookPublisher(srv.URL, "/transfer-service", ModeBinary, time.Second)
+	ev := testEvent
+	ev.AggregateID = ""
+	if err := p.Publish(context.Background(), []service.OutboxEvent{ev}); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := got.header["Ce-Subject"]; ok {
+		t.Fatalf("ce-subject sent for an event without a subject")
+	}
+}
+
+func TestWebhookFailsOnNon2xx(t *testing.T) {
+	srv, _ := webhookServer(t, http.StatusServiceUnavailable)
+	p := NewWebhookPublisher(srv.URL, "/transfer-service", ModeStructured, time.Second)
+	if err := p.Publish(context.Background(), []service.OutboxEvent{testEvent}); err == nil {
+		t.Fatal("expected an error for a 503 response")
+	}
+}
+
+func mustJSON(t *testing.T, v any) string {
+	t.Helper()
+	b, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
@@ -0,0 +1,73 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"transfer-service/internal/service"
+)
+
+// MovePallet records that pallet is now at toLocation, moving it out of its
+// previous location in the inventory read model.
+func (r *PostgresRepo) MovePallet(ctx context.Context, palletID, toLocation, transferID string, at time.Time) error {
+	var prev sql.NullString
+	err := r.DB.QueryRowContext(ctx, `SELECT location_id FROM inventory_pallets WHERE pallet_id=$1 FOR UPDATE`, palletID).Scan(&prev)
+	if err != nil && err != sql.ErrNoRows {
+		return err
+	}
+	if !prev.Valid || prev.String != toLocation {
+		if prev.Valid {
+			q := `UPDATE inventory_locations SET on_hand=GREATEST(on_hand-1, 0), updated_at=$1 WHERE location_id=$2`
+			if _, err := r.DB.ExecContext(ctx, q, at, prev.String); err != nil {
+				return err
+			}
+		}
+		q := `INSERT INTO inventory_locations (location_id, on_hand, updated_at) VALUES ($1, 1, $2)
+            ON CONFLICT (location_id) DO UPDATE SET on_hand=inventory_locations.on_hand+1, updated_at=EXCLUDED.updated_at`
+		if _, err := r.DB.ExecContext(ctx, q, toLocation, at); err != nil {
+			return err
+		}
+	}
+	q := `INSERT INTO inventory_pallets (pallet_id, location_id, last_transfer_id, updated_at) VALUES ($1,$2,$3,$4)
+        ON CONFLICT (pallet_id) DO UPDATE SET location_id=EXCLUDED.location_id, last_transfer_id=EXCLUDED.last_transfer_id, updated_at=EXCLUDED.updated_at`
+	_, err = r.DB.ExecContext(ctx, q, palletID, toLocation, transferID, at)
+	return err
+}
+
+func (r *PostgresRepo) GetLocationInventory(ctx context.Context, locationID string) (*service.LocationInventory, error) {
+	var inv service.LocationInventory
+	row := r.DB.QueryRowContext(ctx, `SELECT location_id, on_hand, updated_at FROM inventory_locations WHERE location_id=$1`, locationID)
+	if err := row.Scan(&inv.LocationID, &inv.OnHand, &inv.UpdatedAt); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, service.ErrNotFound
+		}
+		return nil, err
+	}
+	rows, err := r.DB.QueryContext(ctx, `SELECT pallet_id FROM inventory_pallets WHERE location_id=$1 ORDER BY pallet_id`, locationID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	inv.Pallets = []string{}
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		inv.Pallets = append(inv.Pallets, id)
+	}
+	return &inv, rows.Err()
+}
+
+func (r *PostgresRepo) GetPalletInventory(ctx context.Context, palletID string) (*service.PalletInventory, error) {
+	var p service.PalletInventory
+	row := r.DB.QueryRowContext(ctx, `SELECT pallet_id, location_id, last_transfer_id, updated_at FROM inventory_pallets WHERE pallet_id=$1`, palletID)
+	if err := row.Scan(&p.PalletID, &p.LocationID, &p.LastTransferID, &p.UpdatedAt); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, service.ErrNotFound
+		}
+		return nil, err
+	}
+	return &p, nil
+}
@@ -0,0 +1,77 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+
+	"transfer-service/internal/service"
+)
+
+const locationColumns = `code, zone, room, type, capacity, active, created_at, updated_at`
+
+func scanLocation(row rowScanner) (*service.Location, error) {
+	var l service.Location
+	if err := row.Scan(&l.Code, &l.Zone, &l.Room, &l.Type, &l.Capacity, &l.Active, &l.CreatedAt, &l.UpdatedAt); err != nil {
+		return nil, err
+	}
+	return &l, nil
+}
+
+func (r *PostgresRepo) CreateLocation(ctx context.Context, l *service.Location) error {
+	q := `INSERT INTO locations (` + locationColumns + `) VALUES ($1,$2,$3,$4,$5,$6,$7,$8)`
+	_, err := r.DB.ExecContext(ctx, q, l.Code, l.Zone, l.Room, l.Type, l.Capacity, l.Active, l.CreatedAt, l.UpdatedAt)
+	if isUniqueViolation(err) {
+		return service.ErrDuplicateRequest
+	}
+	return err
+}
+
+func (r *PostgresRepo) GetLocation(ctx context.Context, code string) (*service.Location, error) {
+	l, err := scanLocation(r.DB.QueryRowContext(ctx, `SELECT `+locationColumns+` FROM locations WHERE code=$1`, code))
+	if err == sql.ErrNoRows {
+		return nil, service.ErrNotFound
+	}
+	return l, err
+}
+
+// LockLocation reads a location and holds a row lock on it until the
+// transaction ends, so capacity checks against it are serialised.
+func (r *PostgresRepo) LockLocation(ctx context.Context, code string) (*service.Location, error) {
+	l, err := scanLocation(r.DB.QueryRowContext(ctx, `SELECT `+locationColumns+` FROM locations WHERE code=$1 FOR UPDATE`, code))
+	if err == sql.ErrNoRows {
+		return nil, service.ErrNotFound
+	}
+	return l, err
+}
+
+func (r *PostgresRepo) ListLocations(ctx context.Context, activeOnly bool) ([]service.Location, error) {
+	q := `SELECT ` + locationColumns + ` FROM locations WHERE ($1 = false OR active) ORDER BY code`
+	rows, err := r.DB.QueryContext(ctx, q, activeOnly)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	res := []service.Location{}
+	for rows.Next() {
+		l, err := scanLocation(rows)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, *l)
+	}
+	return res, rows.Err()
+}
+
+func (r *PostgresRepo) UpdateLocation(ctx context.Context, l *service.Location) error {
+	q := `UPDATE locations SET zone=$1, room=$2, type=$3, capacity=$4, active=$5, updated_at=$6 WHERE code=$7`
+	res, err := r.DB.ExecContext(ctx, q, l.Zone, l.Room, l.Type, l.Capacity, l.Active, l.UpdatedAt, l.Code)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return service.ErrNotFound
+	}
+	return nil
+}
@@ -0,0 +1,78 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"transfer-service/internal/service"
+)
+
+const palletColumns = `sscc, sku, lot, expiry, quantity, current_location, status, created_at, updated_at`
+
+func scanPallet(row rowScanner) (*service.Pallet, error) {
+	var p service.Pallet
+	if err := row.Scan(&p.SSCC, &p.SKU, &p.Lot, &p.Expiry, &p.Quantity, &p.CurrentLocation, &p.Status, &p.CreatedAt, &p.UpdatedAt); err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+func (r *PostgresRepo) CreatePallet(ctx context.Context, p *service.Pallet) error {
+	q := `INSERT INTO pallets (` + palletColumns + `) VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9)`
+	_, err := r.DB.ExecContext(ctx, q, p.SSCC, p.SKU, p.Lot, p.Expiry, p.Quantity, p.CurrentLocation, p.Status, p.CreatedAt, p.UpdatedAt)
+	if isUniqueViolation(err) {
+		return service.ErrDuplicateRequest
+	}
+	return err
+}
+
+func (r *PostgresRepo) GetPallet(ctx context.Context, sscc string) (*service.Pallet, error) {
+	p, err := scanPallet(r.DB.QueryRowContext(ctx, `SELECT `+palletColumns+` FROM pallets WHERE sscc=$1`, sscc))
+	if err == sql.ErrNoRows {
+		return nil, service.ErrNotFound
+	}
+	return p, err
+}
+
+// LockPallet is GetPallet with a row lock held until the transaction ends.
+func (r *PostgresRepo) LockPallet(ctx context.Context, sscc string) (*service.Pallet, error) {
+	p, err := scanPallet(r.DB.QueryRowContext(ctx, `SELECT `+palletColumns+` FROM pallets WHERE sscc=$1 FOR UPDATE`, sscc))
+	if err == sql.ErrNoRows {
+		return nil, service.ErrNotFound
+	}
+	return p, err
+}
+
+func (r *PostgresRepo) ListPallets(ctx context.Context, location string) ([]service.Pallet, error) {
+	q := `SELECT ` + palletColumns + ` FROM pallets WHERE ($1 = '' OR current_location = $1) ORDER BY sscc`
+	rows, err := r.DB.QueryContext(ctx, q, location)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	res := []service.Pallet{}
+	for rows.Next() {
+		p, err := scanPallet(rows)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, *p)
+	}
+	return res, rows.Err()
+}
+
+func (r *PostgresRepo) UpdatePalletLocation(ctx context.Context, sscc, location, status string, at time.Time) error {
+	q := `UPDATE pallets SET current_location=$1, status=$2, updated_at=$3 WHERE sscc=$4`
+	_, err := r.DB.ExecContext(ctx, q, location, status, at, sscc)
+	return err
+}
+
+// HasOpenTransfer reports whether the pallet has a pending, accepted or
+// in-progress transfer.
+func (r *PostgresRepo) HasOpenTransfer(ctx context.Context, palletID string) (bool, error) {
+	var exists bool
+	q := `SELECT EXISTS (SELECT 1 FROM transfers WHERE pallet_id=$1 AND status IN ('pending','accepted','in_progress'))`
+	err := r.DB.QueryRowContext(ctx, q, palletID).Scan(&exists)
+	return exists, err
+}
@@ -4,22 +4,68 @@ import (
 	"context"
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"io/ioutil"
-	"path/filepath"
+	"sort"
+	"strings"
 	"time"
 
 	"transfer-service/internal/service"
 
 	"github.com/google/uuid"
+	"github.com/lib/pq"
 	"github.com/rs/zerolog/log"
 )
 
+// DBTX is the subset of *sql.DB and *sql.Tx used by the repo, so the same
+// methods run either standalone or inside a transaction.
+type DBTX interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
 type PostgresRepo struct {
-	DB *sql.DB
+	DB   DBTX
+	pool *sql.DB
+	inTx bool
+}
+
+func NewPostgresRepo(db *sql.DB) *PostgresRepo { return &PostgresRepo{DB: db, pool: db} }
+
+// WithTx runs fn with a repo bound to a single transaction, committing when fn
+// returns nil and rolling back otherwise. Nested calls run inside a savepoint
+// of the outer transaction, so a caller that handles the error can carry on.
+func (r *PostgresRepo) WithTx(ctx context.Context, fn func(service.Repo) error) error {
+	if r.inTx {
+		return r.withSavepoint(ctx, fn)
+	}
+	tx, err := r.pool.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	if err := fn(&PostgresRepo{DB: tx, pool: r.pool, inTx: true}); err != nil {
+		if rbErr := tx.Rollback(); rbErr != nil {
+			log.Error().Err(rbErr).Msg("rollback")
+		}
+		return err
+	}
+	return tx.Commit()
 }
 
-func NewPostgresRepo(db *sql.DB) *PostgresRepo { return &PostgresRepo{DB: db} }
+func (r *PostgresRepo) withSavepoint(ctx context.Context, fn func(service.Repo) error) error {
+	if _, err := r.DB.ExecContext(ctx, `SAVEPOINT nested_tx`); err != nil {
+		return err
+	}
+	if err := fn(r); err != nil {
+		if _, rbErr := r.DB.ExecContext(ctx, `ROLLBACK TO SAVEPOINT nested_tx`); rbErr != nil {
+			log.Error().Err(rbErr).Msg("rollback to savepoint")
+		}
+		return err
+	}
+	_, err := r.DB.ExecContext(ctx, `RELEASE SAVEPOINT nested_tx`)
+	return err
+}
 
 func AutoMigrate(db *sql.DB) error {
 	createTransfers := `CREATE TABLE IF NOT EXISTS transfers (
@@ -30,7 +76,7 @@ func AutoMigrate(db *sql.DB) error {
         status TEXT NOT NULL,
         requested_by TEXT NOT NULL,
         approved_by TEXT,
-        idempotency_key TEXT UNIQUE,
+        idempotency_key TEXT,
         created_at TIMESTAMP DEFAULT NOW(),
         updated_at TIMESTAMP DEFAULT NOW()
     );`
@@ -38,6 +84,126 @@ func AutoMigrate(db *sql.DB) error {
 		return err
 	}
 
+	// idempotency_key is kept on the transfer for tracing only. Keys are
+	// enforced by idempotency_keys, where they expire after their TTL and may
+	// then be reused, so the column must not be unique.
+	alterTransfers := `ALTER TABLE transfers DROP CONSTRAINT IF EXISTS transfers_idempotency_key_key;
+        ALTER TABLE transfers
+        ADD COLUMN IF NOT EXISTS rejected_by TEXT,
+        ADD COLUMN IF NOT EXISTS cancelled_by TEXT,
+        ADD COLUMN IF NOT EXISTS reason TEXT,
+        ADD COLUMN IF NOT EXISTS operator_id TEXT,
+        ADD COLUMN IF NOT EXISTS equipment_id TEXT,
+        ADD COLUMN IF NOT EXISTS accepted_at TIMESTAMP,
+        ADD COLUMN IF NOT EXISTS started_at TIMESTAMP,
+        ADD COLUMN IF NOT EXISTS completed_at TIMESTAMP,
+        ADD COLUMN IF NOT EXISTS move_duration_seconds DOUBLE PRECISION;`
+	if _, err := db.Exec(alterTransfers); err != nil {
+		return err
+	}
+
+	transferIndexes := `CREATE INDEX IF NOT EXISTS idx_transfers_created ON transfers (created_at, id);
+        CREATE INDEX IF NOT EXISTS idx_transfers_status_created ON transfers (status, created_at, id);
+        CREATE INDEX IF NOT EXISTS idx_transfers_pallet ON transfers (pallet_id, created_at);
+        CREATE INDEX IF NOT EXISTS idx_transfers_from ON transfers (from_location, created_at);
+        CREATE INDEX IF NOT EXISTS idx_transfers_to_status ON transfers (to_location, status);
+        CREATE INDEX IF NOT EXISTS idx_transfers_requested_by ON transfers (requested_by, created_at);`
+	if _, err := db.Exec(transferIndexes); err != nil {
+		return err
+	}
+
+	// Transfers recorded before locations were managed refer to codes that
+	// must keep working, so a new locations table is seeded with every code
+	// seen on a transfer. They get the capacity that used to apply to every
+	// location (MAX_CAPACITY_PER_LOCATION=100 in the shipped .env) and can be
+	// adjusted through PUT /locations/{code}.
+	var locationsExist bool
+	if err := db.QueryRow(`SELECT to_regclass('locations') IS NOT NULL`).Scan(&locationsExist); err != nil {
+		return err
+	}
+	if !locationsExist {
+		createLocations := `CREATE TABLE IF NOT EXISTS locations (
+            code TEXT PRIMARY KEY,
+            zone TEXT NOT NULL DEFAULT '',
+            room TEXT NOT NULL DEFAULT '',
+            type TEXT NOT NULL DEFAULT '',
+            capacity INT NOT NULL CHECK (capacity > 0),
+            active BOOLEAN NOT NULL DEFAULT TRUE,
+            created_at TIMESTAMP NOT NULL,
+            updated_at TIMESTAMP NOT NULL
+        );
+        LOCK TABLE transfers IN SHARE MODE;
+        INSERT INTO locations (code, capacity, created_at, updated_at)
+            SELECT DISTINCT code, 100, NOW() AT TIME ZONE 'UTC', NOW() AT TIME ZONE 'UTC'
+            FROM transfers, LATERAL (VALUES (from_location), (to_location)) AS l (code)
+            WHERE code <> ''
+            ON CONFLICT (code) DO NOTHING;`
+		if _, err := db.Exec(createLocations); err != nil {
+			return err
+		}
+	}
+
+	// Likewise every pallet_id seen on a transfer is registered when the
+	// pallets table is created, placed where its latest transfer left it:
+	// at the destination once completed, in transit while in progress and
+	// at the origin otherwise. SKU and quantity are not known from transfers
+	// and are left empty.
+	var palletsExist bool
+	if err := db.QueryRow(`SELECT to_regclass('pallets') IS NOT NULL`).Scan(&palletsExist); err != nil {
+		return err
+	}
+	if !palletsExist {
+		createPallets := `CREATE TABLE IF NOT EXISTS pallets (
+            sscc TEXT PRIMARY KEY,
+            sku TEXT NOT NULL,
+            lot TEXT NOT NULL DEFAULT '',
+            expiry DATE,
+            quantity INT NOT NULL,
+            current_location TEXT NOT NULL REFERENCES locations (code),
+            status TEXT NOT NULL,
+            created_at TIMESTAMP NOT NULL,
+            updated_at TIMESTAMP NOT NULL
+        );
+        CREATE INDEX IF NOT EXISTS idx_pallets_location ON pallets (current_location);
+        LOCK TABLE transfers IN SHARE MODE;
+        INSERT INTO pallets (sscc, sku, quantity, current_location, status, created_at, updated_at)
+            SELECT pallet_id, '', 0,
+                CASE WHEN status = 'completed' THEN to_location ELSE from_location END,
+                CASE WHEN status = 'in_progress' THEN 'in_transit' ELSE 'stored' END,
+                first_seen, NOW() AT TIME ZONE 'UTC'
+            FROM (
+                SELECT DISTINCT ON (pallet_id) pallet_id, status, from_location, to_location,
+                    MIN(created_at) OVER (PARTITION BY pallet_id) AS first_seen
+                FROM transfers
+                ORDER BY pallet_id, created_at DESC, id DESC
+            ) latest
+            WHERE EXISTS (SELECT 1 FROM locations
+                WHERE code = CASE WHEN latest.status = 'completed' THEN latest.to_location ELSE latest.from_location END)
+            ON CONFLICT (sscc) DO NOTHING;`
+		if _, err := db.Exec(createPallets); err != nil {
+			return err
+		}
+	}
+
+	// Older data may hold several open transfers for one pallet. Keep the
+	// most advanced (then oldest) one and cancel the rest so the unique
+	// index below can be built.
+	openTransferIndex := `UPDATE transfers t SET status='cancelled', cancelled_by='migration',
+            reason='duplicate open transfer for pallet', updated_at=NOW()
+        FROM (
+            SELECT id, row_number() OVER (
+                PARTITION BY pallet_id
+                ORDER BY CASE status WHEN 'in_progress' THEN 0 WHEN 'accepted' THEN 1 ELSE 2 END, created_at, id
+            ) AS rn
+            FROM transfers WHERE status IN ('pending','accepted','in_progress')
+        ) d
+        WHERE t.id = d.id AND d.rn > 1;
+    CREATE UNIQUE INDEX IF NOT EXISTS idx_transfers_open_pallet ON transfers (pallet_id)
+        WHERE status IN ('pending','accepted','in_progress');`
+	if _, err := db.Exec(openTransferIndex); err != nil {
+		return err
+	}
+
 	createReadings := `CREATE TABLE IF NOT EXISTS temperature_readings (
         id TEXT PRIMARY KEY,
         room_id TEXT NOT NULL,
@@ -48,6 +214,78 @@ func AutoMigrate(db *sql.DB) error {
 	if _, err := db.Exec(createReadings); err != nil {
 		return err
 	}
+	if _, err := db.Exec(`CREATE INDEX IF NOT EXISTS idx_readings_room_recorded ON temperature_readings (room_id, recorded_at)`); err != nil {
+		return err
+	}
+	// A rollup table is filled from the raw readings when it is first
+	// created, with writers to temperature_readings held off until it
+	// commits, so history served from it covers data ingested before it
+	// existed.
+	for _, res := range service.RollupResolutions {
+		table, unit, err := rollupTable(res)
+		if err != nil {
+			return err
+		}
+		var exists bool
+		if err := db.QueryRow(`SELECT to_regclass($1) IS NOT NULL`, table).Scan(&exists); err != nil {
+			return err
+		}
+		if exists {
+			continue
+		}
+		createRollup := `CREATE TABLE IF NOT EXISTS ` + table + ` (
+            room_id TEXT NOT NULL,
+            bucket TIMESTAMP NOT NULL,
+            min_temp DOUBLE PRECISION NOT NULL,
+            max_temp DOUBLE PRECISION NOT NULL,
+            sum_temp DOUBLE PRECISION NOT NULL,
+            count BIGINT NOT NULL,
+            PRIMARY KEY (room_id, bucket)
+        );
+        LOCK TABLE temperature_readings IN SHARE MODE;
+        INSERT INTO ` + table + ` (room_id, bucket, min_temp, max_temp, sum_temp, count)
+            SELECT room_id, date_trunc('` + unit + `', recorded_at), MIN(temp), MAX(temp), SUM(temp), COUNT(*)
+            FROM temperature_readings GROUP BY 1, 2
+            ON CONFLICT (room_id, bucket) DO NOTHING;`
+		if _, err := db.Exec(createRollup); err != nil {
+			return err
+		}
+	}
+
+	createRooms := `CREATE TABLE IF NOT EXISTS rooms (
+        id TEXT PRIMARY KEY,
+        name TEXT NOT NULL DEFAULT '',
+        type TEXT NOT NULL DEFAULT '',
+        critical_min DOUBLE PRECISION NOT NULL,
+        warning_min DOUBLE PRECISION NOT NULL,
+        warning_max DOUBLE PRECISION NOT NULL,
+        critical_max DOUBLE PRECISION NOT NULL,
+        created_at TIMESTAMP NOT NULL,
+        updated_at TIMESTAMP NOT NULL
+    );`
+	if _, err := db.Exec(createRooms); err != nil {
+		return err
+	}
+	alterRooms := `ALTER TABLE rooms
+        ADD COLUMN IF NOT EXISTS hysteresis DOUBLE PRECISION NOT NULL DEFAULT 0.5,
+        ADD COLUMN IF NOT EXISTS excursion_delay_seconds INT NOT NULL DEFAULT 0,
+        ADD COLUMN IF NOT EXISTS report_interval_seconds INT NOT NULL DEFAULT 0,
+        ADD COLUMN IF NOT EXISTS offline_after_seconds INT NOT NULL DEFAULT 0,
+        ADD COLUMN IF NOT EXISTS trend_rise DOUBLE PRECISION NOT NULL DEFAULT 0,
+        ADD COLUMN IF NOT EXISTS trend_window_seconds INT NOT NULL DEFAULT 0`
+	if _, err := db.Exec(alterRooms); err != nil {
+		return err
+	}
+
+	createHeartbeats := `CREATE TABLE IF NOT EXISTS room_heartbeats (
+        room_id TEXT PRIMARY KEY,
+        last_reading_at TIMESTAMP NOT NULL,
+        last_temp DOUBLE PRECISION NOT NULL,
+        received_at TIMESTAMP NOT NULL
+    );`
+	if _, err := db.Exec(createHeartbeats); err != nil {
+		return err
+	}
 
 	createAlerts := `CREATE TABLE IF NOT EXISTS alerts (
         id TEXT PRIMARY KEY,
@@ -61,6 +299,33 @@ func AutoMigrate(db *sql.DB) error {
 		return err
 	}
 
+	// Alerts used to be one row per out-of-range reading; those legacy rows
+	// are backfilled as already cleared so the open-alert index holds.
+	alterAlerts := `ALTER TABLE alerts
+        ADD COLUMN IF NOT EXISTS condition TEXT NOT NULL DEFAULT 'high',
+        ADD COLUMN IF NOT EXISTS peak_temp DOUBLE PRECISION,
+        ADD COLUMN IF NOT EXISTS updated_at TIMESTAMP,
+        ADD COLUMN IF NOT EXISTS cleared_at TIMESTAMP;
+        UPDATE alerts SET peak_temp=temp, updated_at=created_at, cleared_at=created_at WHERE updated_at IS NULL;
+        CREATE UNIQUE INDEX IF NOT EXISTS idx_alerts_open ON alerts (room_id, condition) WHERE cleared_at IS NULL;
+        ALTER TABLE alerts
+        ADD COLUMN IF NOT EXISTS status TEXT NOT NULL DEFAULT 'open',
+        ADD COLUMN IF NOT EXISTS acknowledged_by TEXT,
+        ADD COLUMN IF NOT EXISTS acknowledge_note TEXT,
+        ADD COLUMN IF NOT EXISTS acknowledged_at TIMESTAMP,
+        ADD COLUMN IF NOT EXISTS resolved_by TEXT,
+        ADD COLUMN IF NOT EXISTS corrective_action TEXT,
+        ADD COLUMN IF NOT EXISTS resolved_at TIMESTAMP,
+        ADD COLUMN IF NOT EXISTS excursion_started_at TIMESTAMP,
+        ADD COLUMN IF NOT EXISTS duration_seconds DOUBLE PRECISION NOT NULL DEFAULT 0;
+        UPDATE alerts SET excursion_started_at=created_at WHERE excursion_started_at IS NULL;
+        CREATE INDEX IF NOT EXISTS idx_alerts_created ON alerts (created_at);
+        CREATE INDEX IF NOT EXISTS idx_alerts_status_created ON alerts (status, created_at);
+        CREATE INDEX IF NOT EXISTS idx_alerts_room_created ON alerts (room_id, created_at);`
+	if _, err := db.Exec(alterAlerts); err != nil {
+		return err
+	}
+
 	createOutbox := `CREATE TABLE IF NOT EXISTS outbox (
         id TEXT PRIMARY KEY,
         aggregate_type TEXT NOT NULL,
@@ -73,6 +338,92 @@ func AutoMigrate(db *sql.DB) error {
 		return err
 	}
 
+	alterOutbox := `ALTER TABLE outbox
+        ADD COLUMN IF NOT EXISTS topic TEXT,
+        ADD COLUMN IF NOT EXISTS attempts INT NOT NULL DEFAULT 0,
+        ADD COLUMN IF NOT EXISTS last_error TEXT,
+        ADD COLUMN IF NOT EXISTS next_attempt_at TIMESTAMP,
+        ADD COLUMN IF NOT EXISTS dead_letter BOOLEAN NOT NULL DEFAULT FALSE,
+        ADD COLUMN IF NOT EXISTS seq BIGSERIAL,
+        ADD COLUMN IF NOT EXISTS xid xid8 NOT NULL DEFAULT pg_current_xact_id(),
+        ADD COLUMN IF NOT EXISTS locked_until TIMESTAMP;
+        CREATE INDEX IF NOT EXISTS idx_outbox_topic ON outbox (topic);
+        CREATE UNIQUE INDEX IF NOT EXISTS idx_outbox_seq ON outbox (seq);
+        CREATE INDEX IF NOT EXISTS idx_outbox_xid_seq ON outbox (xid, seq);
+        CREATE INDEX IF NOT EXISTS idx_outbox_pending ON outbox (created_at) WHERE published = false AND dead_letter = false;`
+	if _, err := db.Exec(alterOutbox); err != nil {
+		return err
+	}
+
+	createIdempotency := `CREATE TABLE IF NOT EXISTS idempotency_keys (
+        key TEXT PRIMARY KEY,
+        request_hash TEXT NOT NULL,
+        status_code INT NOT NULL DEFAULT 0,
+        response_body BYTEA,
+        created_at TIMESTAMP NOT NULL,
+        expires_at TIMESTAMP NOT NULL,
+        lease_expires_at TIMESTAMP NOT NULL,
+        token TEXT NOT NULL
+    );
+    CREATE INDEX IF NOT EXISTS idx_idempotency_expires ON idempotency_keys (expires_at);`
+	if _, err := db.Exec(createIdempotency); err != nil {
+		return err
+	}
+
+	createCheckpoints := `CREATE TABLE IF NOT EXISTS projection_checkpoints (
+        name TEXT PRIMARY KEY,
+        last_xid xid8 NOT NULL DEFAULT '0',
+        last_seq BIGINT NOT NULL DEFAULT 0,
+        updated_at TIMESTAMP NOT NULL
+    );`
+	if _, err := db.Exec(createCheckpoints); err != nil {
+		return err
+	}
+
+	createRetentionPurges := `CREATE TABLE IF NOT EXISTS retention_purges (
+        table_name TEXT PRIMARY KEY,
+        purged_rows BIGINT NOT NULL,
+        last_purged_at TIMESTAMP NOT NULL
+    );`
+	if _, err := db.Exec(createRetentionPurges); err != nil {
+		return err
+	}
+
+	createInventory := `CREATE TABLE IF NOT EXISTS inventory_locations (
+        location_id TEXT PRIMARY KEY,
+        on_hand INT NOT NULL DEFAULT 0,
+        updated_at TIMESTAMP NOT NULL
+    );
+    CREATE TABLE IF NOT EXISTS inventory_pallets (
+        pallet_id TEXT PRIMARY KEY,
+        location_id TEXT NOT NULL,
+        last_transfer_id TEXT NOT NULL,
+        updated_at TIMESTAMP NOT NULL
+    );
+    CREATE INDEX IF NOT EXISTS idx_inventory_pallets_location ON inventory_pallets (location_id);`
+	if _, err := db.Exec(createInventory); err != nil {
+		return err
+	}
+
+	createStats := `CREATE TABLE IF NOT EXISTS room_alert_counts (
+        room_id TEXT NOT NULL,
+        level TEXT NOT NULL,
+        count INT NOT NULL DEFAULT 0,
+        last_alert_at TIMESTAMP NOT NULL,
+        PRIMARY KEY (room_id, level)
+    );
+    CREATE TABLE IF NOT EXISTS operator_stats (
+        operator_id TEXT PRIMARY KEY,
+        completed_moves INT NOT NULL DEFAULT 0,
+        total_move_seconds DOUBLE PRECISION NOT NULL DEFAULT 0,
+        dwell_samples INT NOT NULL DEFAULT 0,
+        total_dwell_seconds DOUBLE PRECISION NOT NULL DEFAULT 0,
+        last_completed_at TIMESTAMP NOT NULL
+    );`
+	if _, err := db.Exec(createStats); err != nil {
+		return err
+	}
+
 	log.Info().Msg("migrations applied")
 	return nil
 }
@@ -84,28 +435,172 @@ func (r *PostgresRepo) CreateTransfer(ctx context.Context, t *service.Transfer,
 		t.ID = uuid.New().String()
 	}
 	now := time.Now().UTC()
-	_, err := r.DB.ExecContext(ctx, q, t.ID, t.PalletID, t.FromLocation, t.ToLocation, t.Status, t.RequestedBy, idempotencyKey, now, now)
+	_, err := r.DB.ExecContext(ctx, q, t.ID, t.PalletID, t.FromLocation, t.ToLocation, t.Status, t.RequestedBy, nullIfEmpty(idempotencyKey), now, now)
+	if isUniqueViolation(err) {
+		return service.ErrDuplicateRequest
+	}
 	return err
 }
 
-func (r *PostgresRepo) GetTransfer(ctx context.Context, id string) (*service.Transfer, error) {
-	q := `SELECT id,pallet_id,from_location,to_location,status,requested_by,approved_by,created_at,updated_at FROM transfers WHERE id=$1`
-	row := r.DB.QueryRowContext(ctx, q, id)
+const transferColumns = `id,pallet_id,from_location,to_location,status,requested_by,approved_by,rejected_by,cancelled_by,reason,operator_id,equipment_id,accepted_at,started_at,completed_at,move_duration_seconds,created_at,updated_at`
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanTransfer(row rowScanner) (*service.Transfer, error) {
 	var t service.Transfer
-	var approved sql.NullString
-	if err := row.Scan(&t.ID, &t.PalletID, &t.FromLocation, &t.ToLocation, &t.Status, &t.RequestedBy, &approved, &t.CreatedAt, &t.UpdatedAt); err != nil {
+	var approved, rejected, cancelled, reason, operator, equipment sql.NullString
+	var acceptedAt, startedAt, completedAt sql.NullTime
+	var duration sql.NullFloat64
+	if err := row.Scan(&t.ID, &t.PalletID, &t.FromLocation, &t.ToLocation, &t.Status, &t.RequestedBy, &approved, &rejected, &cancelled, &reason,
+		&operator, &equipment, &acceptedAt, &startedAt, &completedAt, &duration, &t.CreatedAt, &t.UpdatedAt); err != nil {
 		return nil, err
 	}
-	if approved.Valid {
-		t.ApprovedBy = &approved.String
+	t.ApprovedBy = nullStringPtr(approved)
+	t.RejectedBy = nullStringPtr(rejected)
+	t.CancelledBy = nullStringPtr(cancelled)
+	t.Reason = nullStringPtr(reason)
+	t.OperatorID = nullStringPtr(operator)
+	t.EquipmentID = nullStringPtr(equipment)
+	t.AcceptedAt = nullTimePtr(acceptedAt)
+	t.StartedAt = nullTimePtr(startedAt)
+	t.CompletedAt = nullTimePtr(completedAt)
+	if duration.Valid {
+		t.MoveDurationSeconds = &duration.Float64
 	}
 	return &t, nil
 }
 
-func (r *PostgresRepo) UpdateTransferStatus(ctx context.Context, id, status string, approvedBy *string) error {
-	q := `UPDATE transfers SET status=$1, approved_by=$2, updated_at=NOW() WHERE id=$3`
-	_, err := r.DB.ExecContext(ctx, q, status, approvedBy, id)
-	return err
+func (r *PostgresRepo) GetTransfer(ctx context.Context, id string) (*service.Transfer, error) {
+	q := `SELECT ` + transferColumns + ` FROM transfers WHERE id=$1`
+	return scanTransfer(r.DB.QueryRowContext(ctx, q, id))
+}
+
+// ListTransfers builds the filter dynamically and pages with a keyset
+// condition on (created_at, id), which stays stable while rows are inserted.
+func (r *PostgresRepo) ListTransfers(ctx context.Context, f service.TransferFilter, after *service.TransferCursor, limit int) ([]service.Transfer, error) {
+	var where []string
+	var args []interface{}
+	arg := func(v interface{}) string {
+		args = append(args, v)
+		return fmt.Sprintf("$%d", len(args))
+	}
+	if len(f.Status) > 0 {
+		where = append(where, "status = ANY("+arg(pq.Array(f.Status))+")")
+	}
+	if f.PalletID != "" {
+		where = append(where, "pallet_id = "+arg(f.PalletID))
+	}
+	if f.FromLocation != "" {
+		where = append(where, "from_location = "+arg(f.FromLocation))
+	}
+	if f.ToLocation != "" {
+		where = append(where, "to_location = "+arg(f.ToLocation))
+	}
+	if f.RequestedBy != "" {
+		where = append(where, "requested_by = "+arg(f.RequestedBy))
+	}
+	if f.CreatedFrom != nil {
+		where = append(where, "created_at >= "+arg(f.CreatedFrom.UTC()))
+	}
+	if f.CreatedTo != nil {
+		where = append(where, "created_at < "+arg(f.CreatedTo.UTC()))
+	}
+	order, cmp := "DESC", "<"
+	if f.Ascending {
+		order, cmp = "ASC", ">"
+	}
+	if after != nil {
+		where = append(where, fmt.Sprintf("(created_at, id) %s (%s, %s)", cmp, arg(after.CreatedAt.UTC()), arg(after.ID)))
+	}
+	q := `SELECT ` + transferColumns + ` FROM transfers`
+	if len(where) > 0 {
+		q += " WHERE " + strings.Join(where, " AND ")
+	}
+	q += fmt.Sprintf(" ORDER BY created_at %s, id %s LIMIT %s", order, order, arg(limit))
+
+	rows, err := r.DB.QueryContext(ctx, q, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var res []service.Transfer
+	for rows.Next() {
+		t, err := scanTransfer(rows)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, *t)
+	}
+	return res, rows.Err()
+}
+
+// UpdateTransferStatus only applies when the row is still in the expected
+// status, so concurrent operators cannot both move the same transfer.
+func (r *PostgresRepo) UpdateTransferStatus(ctx context.Context, id, expected, status string, approvedBy *string) error {
+	q := `UPDATE transfers SET status=$1, approved_by=$2, updated_at=NOW(),
+        accepted_at = CASE WHEN $1 = 'accepted' THEN (NOW() AT TIME ZONE 'UTC') ELSE accepted_at END
+        WHERE id=$3 AND status=$4`
+	res, err := r.DB.ExecContext(ctx, q, status, approvedBy, id, expected)
+	return expectTransition(res, err)
+}
+
+// StartTransfer moves an accepted transfer to in_progress and records who
+// picked up the pallet with which equipment.
+func (r *PostgresRepo) StartTransfer(ctx context.Context, id, expected, operatorID, equipmentID string, startedAt time.Time) error {
+	q := `UPDATE transfers SET status=$1, operator_id=$2, equipment_id=$3, started_at=$4, updated_at=NOW() WHERE id=$5 AND status=$6`
+	res, err := r.DB.ExecContext(ctx, q, service.StatusInProgress, operatorID, equipmentID, startedAt, id, expected)
+	return expectTransition(res, err)
+}
+
+// CompleteTransfer marks a transfer completed along with its move duration.
+func (r *PostgresRepo) CompleteTransfer(ctx context.Context, id, expected string, completedAt time.Time, moveDuration time.Duration) error {
+	q := `UPDATE transfers SET status=$1, completed_at=$2, move_duration_seconds=$3, updated_at=NOW() WHERE id=$4 AND status=$5`
+	res, err := r.DB.ExecContext(ctx, q, service.StatusCompleted, completedAt, moveDuration.Seconds(), id, expected)
+	return expectTransition(res, err)
+}
+
+// expectTransition turns a conditional update that matched no row into
+// service.ErrStaleStatus.
+func expectTransition(res sql.Result, err error) error {
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return service.ErrStaleStatus
+	}
+	return nil
+}
+
+// CloseTransfer sets a terminal status together with the actor and reason.
+// The actor is stored in rejected_by or cancelled_by depending on status.
+func (r *PostgresRepo) CloseTransfer(ctx context.Context, id, expected, status, actor, reason string) error {
+	col := "cancelled_by"
+	if status == service.StatusRejected {
+		col = "rejected_by"
+	}
+	q := fmt.Sprintf(`UPDATE transfers SET status=$1, %s=$2, reason=$3, updated_at=NOW() WHERE id=$4 AND status=$5`, col)
+	res, err := r.DB.ExecContext(ctx, q, status, actor, reason, id, expected)
+	return expectTransition(res, err)
+}
+
+func nullStringPtr(ns sql.NullString) *string {
+	if !ns.Valid {
+		return nil
+	}
+	return &ns.String
+}
+
+func nullTimePtr(nt sql.NullTime) *time.Time {
+	if !nt.Valid {
+		return nil
+	}
+	return &nt.Time
 }
 
 func (r *PostgresRepo) CountByDestination(ctx context.Context, to string) (int, error) {
@@ -125,47 +620,235 @@ func (r *PostgresRepo) InsertOutbox(ctx context.Context, aggregateType, aggregat
 		return err
 	}
 	id := uuid.New().String()
-	q := `INSERT INTO outbox (id, aggregate_type, aggregate_id, payload, published, created_at) VALUES ($1,$2,$3,$4,false,$5)`
-	_, err = r.DB.ExecContext(ctx, q, id, aggregateType, aggregateID, string(b), time.Now().UTC())
+	q := `INSERT INTO outbox (id, aggregate_type, aggregate_id, topic, payload, published, created_at) VALUES ($1,$2,$3,$4,$5,false,$6)`
+	_, err = r.DB.ExecContext(ctx, q, id, aggregateType, aggregateID, topic, string(b), time.Now().UTC())
 	return err
 }
 
-type OutboxEvent struct {
-	ID            string `json:"id"`
-	AggregateType string `json:"aggregate_type"`
-	AggregateID   string `json:"aggregate_id"`
-	Payload       string `json:"payload"`
-}
+const outboxColumns = `id, seq, xid, aggregate_type, aggregate_id, COALESCE(topic, aggregate_type), payload, attempts, last_error, next_attempt_at, dead_letter, created_at`
 
-func (r *PostgresRepo) FlushOutboxAndMark(ctx context.Context, outboxDir string) error {
-	q := `SELECT id, aggregate_type, aggregate_id, payload FROM outbox WHERE published = false ORDER BY created_at ASC`
-	rows, err := r.DB.QueryContext(ctx, q)
-	if err != nil {
-		return err
-	}
+func scanOutboxEvents(rows *sql.Rows) ([]service.OutboxEvent, error) {
 	defer rows.Close()
-	var events []OutboxEvent
+	var events []service.OutboxEvent
 	for rows.Next() {
-		var e OutboxEvent
-		if err := rows.Scan(&e.ID, &e.AggregateType, &e.AggregateID, &e.Payload); err != nil {
-			return err
+		var e service.OutboxEvent
+		var lastErr sql.NullString
+		var next sql.NullTime
+		if err := rows.Scan(&e.ID, &e.Seq, &e.Xid, &e.AggregateType, &e.AggregateID, &e.Topic, &e.Payload, &e.Attempts, &lastErr, &next, &e.DeadLetter, &e.CreatedAt); err != nil {
+			return nil, err
 		}
+		e.LastError = nullStringPtr(lastErr)
+		e.NextAttemptAt = nullTimePtr(next)
 		events = append(events, e)
 	}
-	for _, ev := range events {
-		fname := fmt.Sprintf("%s_%s.json", ev.AggregateType, ev.ID)
-		path := filepath.Join(outboxDir, fname)
-		if err := ioutil.WriteFile(path, []byte(ev.Payload), 0o644); err != nil {
-			return err
-		}
-		if _, err := r.DB.ExecContext(ctx, `UPDATE outbox SET published=true WHERE id=$1`, ev.ID); err != nil {
-			return err
+	return events, rows.Err()
+}
+
+// ClaimOutboxBatch leases up to limit events that are due for (re)delivery,
+// oldest first, until lockedUntil. The lease is taken and committed in one
+// statement, so no row lock or transaction stays open while the events are
+// published; other relays skip leased rows until the lease runs out.
+func (r *PostgresRepo) ClaimOutboxBatch(ctx context.Context, limit int, now, lockedUntil time.Time) ([]service.OutboxEvent, error) {
+	q := `UPDATE outbox SET locked_until=$3 WHERE id IN (
+            SELECT id FROM outbox
+            WHERE published = false AND dead_letter = false AND (next_attempt_at IS NULL OR next_attempt_at <= $2)
+                AND (locked_until IS NULL OR locked_until <= $2)
+            ORDER BY created_at ASC LIMIT $1 FOR UPDATE SKIP LOCKED)
+        RETURNING ` + outboxColumns
+	rows, err := r.DB.QueryContext(ctx, q, limit, now, lockedUntil)
+	if err != nil {
+		return nil, err
+	}
+	events, err := scanOutboxEvents(rows)
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(events, func(i, j int) bool {
+		if !events[i].CreatedAt.Equal(events[j].CreatedAt) {
+			return events[i].CreatedAt.Before(events[j].CreatedAt)
 		}
-		log.Info().Str("outbox_file", path).Msg("wrote outbox event")
+		return events[i].Seq < events[j].Seq
+	})
+	return events, nil
+}
+
+func (r *PostgresRepo) MarkOutboxPublished(ctx context.Context, ids []string) error {
+	_, err := r.DB.ExecContext(ctx, `UPDATE outbox SET published=true, locked_until=NULL WHERE id = ANY($1)`, pq.Array(ids))
+	return err
+}
+
+// MarkOutboxFailed records a failed delivery attempt and when to try again,
+// releasing the lease.
+func (r *PostgresRepo) MarkOutboxFailed(ctx context.Context, id, lastError string, nextAttemptAt time.Time, deadLetter bool) error {
+	q := `UPDATE outbox SET attempts=attempts+1, last_error=$1, next_attempt_at=$2, dead_letter=$3, locked_until=NULL WHERE id=$4`
+	_, err := r.DB.ExecContext(ctx, q, lastError, nextAttemptAt, deadLetter, id)
+	return err
+}
+
+func (r *PostgresRepo) ListDeadLetters(ctx context.Context, limit int) ([]service.OutboxEvent, error) {
+	q := `SELECT ` + outboxColumns + ` FROM outbox WHERE dead_letter = true ORDER BY created_at ASC LIMIT $1`
+	rows, err := r.DB.QueryContext(ctx, q, limit)
+	if err != nil {
+		return nil, err
+	}
+	return scanOutboxEvents(rows)
+}
+
+func (r *PostgresRepo) RequeueDeadLetter(ctx context.Context, id string) error {
+	q := `UPDATE outbox SET dead_letter=false, attempts=0, next_attempt_at=NULL WHERE id=$1 AND dead_letter = true`
+	res, err := r.DB.ExecContext(ctx, q, id)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return service.ErrNotFound
+	}
+	return nil
+}
+
+// ListOutboxAfter returns events past the given position in (xid, seq)
+// order, published or not, optionally limited to topics. Projections read
+// the outbox as an event log through this.
+//
+// seq is assigned at insert time, so a transaction holding a lower seq can
+// commit after a higher one has been read. Only rows written by transactions
+// older than every in-flight one are returned: those can no longer change,
+// and anything committed later sorts after them.
+func (r *PostgresRepo) ListOutboxAfter(ctx context.Context, after service.OutboxPosition, topics []string, limit int) ([]service.OutboxEvent, error) {
+	q := `SELECT ` + outboxColumns + ` FROM outbox
+        WHERE (xid, seq) > ($1::xid8, $2) AND xid < pg_snapshot_xmin(pg_current_snapshot())
+            AND (cardinality($3::text[]) = 0 OR COALESCE(topic, aggregate_type) = ANY($3))
+        ORDER BY xid ASC, seq ASC LIMIT $4`
+	if topics == nil {
+		topics = []string{}
+	}
+	rows, err := r.DB.QueryContext(ctx, q, after.Xid, after.Seq, pq.Array(topics), limit)
+	if err != nil {
+		return nil, err
+	}
+	return scanOutboxEvents(rows)
+}
+
+func (r *PostgresRepo) CountOutboxAfter(ctx context.Context, afterSeq int64, topics []string) (int, error) {
+	q := `SELECT COUNT(1) FROM outbox WHERE seq > $1 AND (cardinality($2::text[]) = 0 OR COALESCE(topic, aggregate_type) = ANY($2))`
+	if topics == nil {
+		topics = []string{}
+	}
+	var n int
+	err := r.DB.QueryRowContext(ctx, q, afterSeq, pq.Array(topics)).Scan(&n)
+	return n, err
+}
+
+// Projection checkpoint methods
+
+// GetCheckpoint returns the last processed outbox position for a projection
+// and locks the row, so only one replica advances a projection at a time.
+func (r *PostgresRepo) GetCheckpoint(ctx context.Context, name string) (service.OutboxPosition, error) {
+	var pos service.OutboxPosition
+	if _, err := r.DB.ExecContext(ctx, `INSERT INTO projection_checkpoints (name, last_seq, updated_at) VALUES ($1, 0, $2) ON CONFLICT (name) DO NOTHING`, name, time.Now().UTC()); err != nil {
+		return pos, err
+	}
+	err := r.DB.QueryRowContext(ctx, `SELECT last_xid, last_seq FROM projection_checkpoints WHERE name=$1 FOR UPDATE`, name).Scan(&pos.Xid, &pos.Seq)
+	return pos, err
+}
+
+func (r *PostgresRepo) SaveCheckpoint(ctx context.Context, name string, pos service.OutboxPosition) error {
+	_, err := r.DB.ExecContext(ctx, `UPDATE projection_checkpoints SET last_xid=$1::xid8, last_seq=$2, updated_at=$3 WHERE name=$4`, pos.Xid, pos.Seq, time.Now().UTC(), name)
+	return err
+}
+
+func (r *PostgresRepo) TruncateReadModel(ctx context.Context, tables ...string) error {
+	if len(tables) == 0 {
+		return nil
+	}
+	quoted := make([]string, len(tables))
+	for i, t := range tables {
+		quoted[i] = pq.QuoteIdentifier(t)
+	}
+	_, err := r.DB.ExecContext(ctx, `TRUNCATE `+strings.Join(quoted, ", "))
+	return err
+}
+
+// Idempotency methods
+
+// ReserveIdempotencyKey inserts a pending record for key owned by token,
+// taking over the row if the previous one has expired. When the key is live
+// it returns the stored record and reserved=false.
+func (r *PostgresRepo) ReserveIdempotencyKey(ctx context.Context, key, requestHash, token string, now, leaseExpiresAt, expiresAt time.Time) (*service.IdempotencyRecord, bool, error) {
+	q := `INSERT INTO idempotency_keys (key, request_hash, status_code, response_body, created_at, expires_at, lease_expires_at, token)
+        VALUES ($1,$2,0,NULL,$3,$4,$5,$6)
+        ON CONFLICT (key) DO UPDATE SET request_hash=EXCLUDED.request_hash, status_code=0, response_body=NULL,
+            created_at=EXCLUDED.created_at, expires_at=EXCLUDED.expires_at, lease_expires_at=EXCLUDED.lease_expires_at,
+            token=EXCLUDED.token
+        WHERE idempotency_keys.expires_at < $3
+            OR (idempotency_keys.status_code = 0 AND idempotency_keys.lease_expires_at < $3
+                AND idempotency_keys.request_hash = EXCLUDED.request_hash)`
+	res, err := r.DB.ExecContext(ctx, q, key, requestHash, now, expiresAt, leaseExpiresAt, token)
+	if err != nil {
+		return nil, false, err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return nil, false, err
+	} else if n == 1 {
+		return nil, true, nil
+	}
+	var rec service.IdempotencyRecord
+	row := r.DB.QueryRowContext(ctx, `SELECT key, request_hash, status_code, response_body, created_at, expires_at, lease_expires_at FROM idempotency_keys WHERE key=$1`, key)
+	if err := row.Scan(&rec.Key, &rec.RequestHash, &rec.StatusCode, &rec.ResponseBody, &rec.CreatedAt, &rec.ExpiresAt, &rec.LeaseExpiresAt); err != nil {
+		return nil, false, err
+	}
+	return &rec, false, nil
+}
+
+// SaveIdempotencyResponse settles the pending reservation of key owned by
+// token. It returns service.ErrIdempotencyLeaseLost if another request has
+// taken the key over since.
+func (r *PostgresRepo) SaveIdempotencyResponse(ctx context.Context, key, token string, statusCode int, body []byte) error {
+	res, err := r.DB.ExecContext(ctx, `UPDATE idempotency_keys SET status_code=$1, response_body=$2 WHERE key=$3 AND token=$4 AND status_code=0`, statusCode, body, key, token)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return service.ErrIdempotencyLeaseLost
 	}
 	return nil
 }
 
+// DeleteIdempotencyKey drops the pending reservation of key if token still
+// owns it; a reservation taken over by another request is left alone.
+func (r *PostgresRepo) DeleteIdempotencyKey(ctx context.Context, key, token string) error {
+	_, err := r.DB.ExecContext(ctx, `DELETE FROM idempotency_keys WHERE key=$1 AND token=$2 AND status_code=0`, key, token)
+	return err
+}
+
+func (r *PostgresRepo) PurgeIdempotencyKeys(ctx context.Context, now time.Time) (int64, error) {
+	res, err := r.DB.ExecContext(ctx, `DELETE FROM idempotency_keys WHERE expires_at < $1`, now)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+func nullIfEmpty(s string) interface{} {
+	if s == "" {
+		return nil
+	}
+	return s
+}
+
+func isUniqueViolation(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23505"
+}
+
 // Temperature methods
 func (r *PostgresRepo) InsertReading(ctx context.Context, rd service.TemperatureReading) error {
 	q := `INSERT INTO temperature_readings (id, room_id, temp, recorded_at, created_at) VALUES ($1,$2,$3,$4,$5)`
@@ -174,26 +857,207 @@ func (r *PostgresRepo) InsertReading(ctx context.Context, rd service.Temperature
 	return err
 }
 
+// ExcursionWindow returns the run of consecutive readings up to at that are
+// beyond threshold in the direction of condition: everything recorded after
+// the room's last in-band reading.
+func (r *PostgresRepo) ExcursionWindow(ctx context.Context, roomID, condition string, threshold float64, at time.Time) (*service.ExcursionWindow, error) {
+	beyond := "temp > $3"
+	if condition == service.ConditionLow {
+		beyond = "temp < $3"
+	}
+	q := `SELECT MIN(recorded_at), MAX(temp), MIN(temp), COUNT(*) FROM temperature_readings
+        WHERE room_id=$1 AND recorded_at <= $2 AND recorded_at > COALESCE(
+            (SELECT MAX(recorded_at) FROM temperature_readings
+                WHERE room_id=$1 AND recorded_at <= $2 AND NOT (` + beyond + `)),
+            '-infinity'::timestamp)`
+	var start sql.NullTime
+	var maxTemp, minTemp sql.NullFloat64
+	w := service.ExcursionWindow{End: at}
+	if err := r.DB.QueryRowContext(ctx, q, roomID, at, threshold).Scan(&start, &maxTemp, &minTemp, &w.Readings); err != nil {
+		return nil, err
+	}
+	if w.Readings == 0 {
+		return &w, nil
+	}
+	w.Start = start.Time
+	w.PeakTemp = maxTemp.Float64
+	if condition == service.ConditionLow {
+		w.PeakTemp = minTemp.Float64
+	}
+	return &w, nil
+}
+
+func (r *PostgresRepo) ListReadings(ctx context.Context, roomID string, from, to time.Time, limit int) ([]service.TemperatureReading, error) {
+	q := `SELECT room_id, temp, recorded_at FROM temperature_readings
+        WHERE room_id=$1 AND recorded_at >= $2 AND recorded_at < $3
+        ORDER BY recorded_at LIMIT $4`
+	rows, err := r.DB.QueryContext(ctx, q, roomID, from, to, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	res := []service.TemperatureReading{}
+	for rows.Next() {
+		var rd service.TemperatureReading
+		if err := rows.Scan(&rd.RoomID, &rd.Temp, &rd.Ts); err != nil {
+			return nil, err
+		}
+		res = append(res, rd)
+	}
+	return res, rows.Err()
+}
+
+// BucketReadings aggregates readings into epoch-aligned buckets; empty
+// buckets are omitted.
+func (r *PostgresRepo) BucketReadings(ctx context.Context, roomID string, from, to time.Time, bucket time.Duration) ([]service.TemperatureBucket, error) {
+	q := `SELECT 'epoch'::timestamp + floor(extract(epoch FROM recorded_at) / $4::bigint) * $4::bigint * interval '1 second' AS ts,
+            MIN(temp), AVG(temp), MAX(temp), COUNT(*)
+        FROM temperature_readings
+        WHERE room_id=$1 AND recorded_at >= $2 AND recorded_at < $3
+        GROUP BY ts ORDER BY ts`
+	rows, err := r.DB.QueryContext(ctx, q, roomID, from, to, int64(bucket/time.Second))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	res := []service.TemperatureBucket{}
+	for rows.Next() {
+		var b service.TemperatureBucket
+		if err := rows.Scan(&b.Ts, &b.Min, &b.Avg, &b.Max, &b.Count); err != nil {
+			return nil, err
+		}
+		res = append(res, b)
+	}
+	return res, rows.Err()
+}
+
+// MinTempBetween returns the lowest reading of the room in [from, to] and
+// how many readings that range holds.
+func (r *PostgresRepo) MinTempBetween(ctx context.Context, roomID string, from, to time.Time) (float64, int, error) {
+	var min sql.NullFloat64
+	var n int
+	q := `SELECT MIN(temp), COUNT(*) FROM temperature_readings WHERE room_id=$1 AND recorded_at >= $2 AND recorded_at <= $3`
+	if err := r.DB.QueryRowContext(ctx, q, roomID, from, to).Scan(&min, &n); err != nil {
+		return 0, 0, err
+	}
+	return min.Float64, n, nil
+}
+
+const alertColumns = `id, room_id, condition, level, status, temp, peak_temp, message,
+    acknowledged_by, acknowledge_note, resolved_by, corrective_action,
+    excursion_started_at, duration_seconds,
+    created_at, updated_at, cleared_at, acknowledged_at, resolved_at`
+
+func scanAlert(row rowScanner) (*service.Alert, error) {
+	var a service.Alert
+	var ackBy, ackNote, resolvedBy, action sql.NullString
+	var cleared, acked, resolved sql.NullTime
+	if err := row.Scan(&a.ID, &a.RoomID, &a.Condition, &a.Level, &a.Status, &a.Temp, &a.PeakTemp, &a.Message,
+		&ackBy, &ackNote, &resolvedBy, &action,
+		&a.ExcursionStartedAt, &a.DurationSeconds,
+		&a.Created, &a.UpdatedAt, &cleared, &acked, &resolved); err != nil {
+		return nil, err
+	}
+	a.AcknowledgedBy, a.AcknowledgeNote = ackBy.String, ackNote.String
+	a.ResolvedBy, a.CorrectiveAction = resolvedBy.String, action.String
+	a.ClearedAt = nullTimePtr(cleared)
+	a.AcknowledgedAt = nullTimePtr(acked)
+	a.ResolvedAt = nullTimePtr(resolved)
+	return &a, nil
+}
+
 func (r *PostgresRepo) CreateAlert(ctx context.Context, a *service.Alert) error {
-	q := `INSERT INTO alerts (id, room_id, temp, level, message, created_at) VALUES ($1,$2,$3,$4,$5,$6)`
-	_, err := r.DB.ExecContext(ctx, q, a.ID, a.RoomID, a.Temp, a.Level, a.Message, a.Created)
+	q := `INSERT INTO alerts (id, room_id, condition, level, status, temp, peak_temp, message, excursion_started_at, duration_seconds, created_at, updated_at)
+        VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11,$12)`
+	_, err := r.DB.ExecContext(ctx, q, a.ID, a.RoomID, a.Condition, a.Level, a.Status, a.Temp, a.PeakTemp, a.Message, a.ExcursionStartedAt, a.DurationSeconds, a.Created, a.UpdatedAt)
+	if isUniqueViolation(err) {
+		return service.ErrConflict
+	}
 	return err
 }
 
-func (r *PostgresRepo) ListAlerts(ctx context.Context) ([]service.Alert, error) {
-	q := `SELECT id, room_id, temp, level, message, created_at FROM alerts ORDER BY created_at DESC LIMIT 100`
-	rows, err := r.DB.QueryContext(ctx, q)
+// LockRoomAlerts serialises alert evaluation for a room until the end of
+// the transaction, so concurrent ingests cannot open duplicate alerts.
+func (r *PostgresRepo) LockRoomAlerts(ctx context.Context, roomID string) error {
+	_, err := r.DB.ExecContext(ctx, `SELECT pg_advisory_xact_lock(hashtext('alerts:' || $1))`, roomID)
+	return err
+}
+
+func (r *PostgresRepo) GetOpenAlert(ctx context.Context, roomID, condition string) (*service.Alert, error) {
+	q := `SELECT ` + alertColumns + ` FROM alerts WHERE room_id=$1 AND condition=$2 AND cleared_at IS NULL`
+	a, err := scanAlert(r.DB.QueryRowContext(ctx, q, roomID, condition))
+	if err == sql.ErrNoRows {
+		return nil, service.ErrNotFound
+	}
+	return a, err
+}
+
+func (r *PostgresRepo) GetAlert(ctx context.Context, id string) (*service.Alert, error) {
+	a, err := scanAlert(r.DB.QueryRowContext(ctx, `SELECT `+alertColumns+` FROM alerts WHERE id=$1`, id))
+	if err == sql.ErrNoRows {
+		return nil, service.ErrNotFound
+	}
+	return a, err
+}
+
+func (r *PostgresRepo) LockAlert(ctx context.Context, id string) (*service.Alert, error) {
+	a, err := scanAlert(r.DB.QueryRowContext(ctx, `SELECT `+alertColumns+` FROM alerts WHERE id=$1 FOR UPDATE`, id))
+	if err == sql.ErrNoRows {
+		return nil, service.ErrNotFound
+	}
+	return a, err
+}
+
+func (r *PostgresRepo) UpdateAlert(ctx context.Context, a *service.Alert) error {
+	q := `UPDATE alerts SET level=$1, status=$2, temp=$3, peak_temp=$4, message=$5,
+            acknowledged_by=$6, acknowledge_note=$7, acknowledged_at=$8,
+            resolved_by=$9, corrective_action=$10, resolved_at=$11,
+            duration_seconds=$12, updated_at=$13, cleared_at=$14
+        WHERE id=$15`
+	_, err := r.DB.ExecContext(ctx, q, a.Level, a.Status, a.Temp, a.PeakTemp, a.Message,
+		nullIfEmpty(a.AcknowledgedBy), nullIfEmpty(a.AcknowledgeNote), a.AcknowledgedAt,
+		nullIfEmpty(a.ResolvedBy), nullIfEmpty(a.CorrectiveAction), a.ResolvedAt,
+		a.DurationSeconds, a.UpdatedAt, a.ClearedAt, a.ID)
+	return err
+}
+
+func (r *PostgresRepo) ListAlerts(ctx context.Context, f service.AlertFilter) ([]service.Alert, error) {
+	var where []string
+	var args []interface{}
+	arg := func(v interface{}) string {
+		args = append(args, v)
+		return fmt.Sprintf("$%d", len(args))
+	}
+	if len(f.Status) > 0 {
+		where = append(where, "status = ANY("+arg(pq.Array(f.Status))+")")
+	}
+	if f.RoomID != "" {
+		where = append(where, "room_id = "+arg(f.RoomID))
+	}
+	if f.From != nil {
+		where = append(where, "created_at >= "+arg(f.From.UTC()))
+	}
+	if f.To != nil {
+		where = append(where, "created_at < "+arg(f.To.UTC()))
+	}
+	q := `SELECT ` + alertColumns + ` FROM alerts`
+	if len(where) > 0 {
+		q += " WHERE " + strings.Join(where, " AND ")
+	}
+	q += " ORDER BY created_at DESC, id DESC LIMIT " + arg(f.Limit)
+
+	rows, err := r.DB.QueryContext(ctx, q, args...)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
-	var res []service.Alert
+	res := []service.Alert{}
 	for rows.Next() {
-		var a service.Alert
-		if err := rows.Scan(&a.ID, &a.RoomID, &a.Temp, &a.Level, &a.Message, &a.Created); err != nil {
+		a, err := scanAlert(rows)
+		if err != nil {
 			return nil, err
 		}
-		res = append(res, a)
+		res = append(res, *a)
 	}
-	return res, nil
+	return res, rows.Err()
 }
@@ -0,0 +1,117 @@
+package repo
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+
+	"transfer-service/internal/service"
+)
+
+// retentionTarget describes how the policy's table is purged: the timestamp
+// column that decides expiry and any extra eligibility condition.
+func retentionTarget(pol service.RetentionPolicy) (string, string, error) {
+	switch pol.Table {
+	case service.RetentionReadings:
+		return "recorded_at", "TRUE", nil
+	case service.RetentionOutbox:
+		// Only published events every consumer has already applied. A
+		// consumer without a checkpoint has applied nothing; checkpoints of
+		// other names are ignored.
+		where := `published AND NOT dead_letter`
+		if len(pol.Consumers) > 0 {
+			names := make([]string, len(pol.Consumers))
+			for i, n := range pol.Consumers {
+				names[i] = pq.QuoteLiteral(n)
+			}
+			where += ` AND NOT EXISTS (SELECT 1 FROM unnest(ARRAY[` + strings.Join(names, ", ") + `]::text[]) AS p(name)
+            LEFT JOIN projection_checkpoints c ON c.name = p.name
+            WHERE c.name IS NULL OR (c.last_xid, c.last_seq) < (xid, seq))`
+		}
+		return "created_at", where, nil
+	}
+	return "", "", fmt.Errorf("no retention target %q", pol.Table)
+}
+
+// ExpiredDays lists the UTC days before cutoff that still hold purgeable
+// rows of table, oldest first.
+func (r *PostgresRepo) ExpiredDays(ctx context.Context, pol service.RetentionPolicy, cutoff time.Time) ([]time.Time, error) {
+	ts, where, err := retentionTarget(pol)
+	if err != nil {
+		return nil, err
+	}
+	q := `SELECT DISTINCT date_trunc('day', ` + ts + `) AS day FROM ` + pq.QuoteIdentifier(pol.Table) + `
+        WHERE ` + ts + ` < $1 AND ` + where + ` ORDER BY day`
+	rows, err := r.DB.QueryContext(ctx, q, cutoff)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var res []time.Time
+	for rows.Next() {
+		var d time.Time
+		if err := rows.Scan(&d); err != nil {
+			return nil, err
+		}
+		res = append(res, d.UTC())
+	}
+	return res, rows.Err()
+}
+
+// PurgeExpiredBatch deletes up to limit of the oldest purgeable rows of
+// table recorded on day and calls fn with the id and JSON encoding of each,
+// in time order, then adds them to the table's purged row count. Run it
+// inside WithTx: the deletion only sticks if the transaction commits, and
+// rows already claimed by a concurrent purger are skipped.
+func (r *PostgresRepo) PurgeExpiredBatch(ctx context.Context, pol service.RetentionPolicy, day time.Time, limit int, fn func(id string, row []byte) error) (int, error) {
+	ts, where, err := retentionTarget(pol)
+	if err != nil {
+		return 0, err
+	}
+	table := pq.QuoteIdentifier(pol.Table)
+	q := `WITH batch AS (
+            SELECT id FROM ` + table + `
+            WHERE ` + ts + ` >= $1 AND ` + ts + ` < $1::timestamp + interval '1 day' AND ` + where + `
+            ORDER BY ` + ts + `, id LIMIT $2 FOR UPDATE SKIP LOCKED
+        ), gone AS (
+            DELETE FROM ` + table + ` t USING batch WHERE t.id = batch.id RETURNING t.*
+        )
+        SELECT id, row_to_json(gone)::text FROM gone ORDER BY ` + ts + `, id`
+	rows, err := r.DB.QueryContext(ctx, q, day, limit)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+	n := 0
+	for rows.Next() {
+		var id, row string
+		if err := rows.Scan(&id, &row); err != nil {
+			return n, err
+		}
+		if err := fn(id, []byte(row)); err != nil {
+			return n, err
+		}
+		n++
+	}
+	if err := rows.Err(); err != nil {
+		return n, err
+	}
+	if n == 0 {
+		return 0, nil
+	}
+	q = `INSERT INTO retention_purges (table_name, purged_rows, last_purged_at) VALUES ($1, $2, $3)
+        ON CONFLICT (table_name) DO UPDATE SET
+            purged_rows=retention_purges.purged_rows+EXCLUDED.purged_rows, last_purged_at=EXCLUDED.last_purged_at`
+	_, err = r.DB.ExecContext(ctx, q, pol.Table, n, time.Now().UTC())
+	return n, err
+}
+
+// PurgedRows returns how many rows of table retention has deleted so far.
+func (r *PostgresRepo) PurgedRows(ctx context.Context, table string) (int64, error) {
+	var n int64
+	err := r.DB.QueryRowContext(ctx, `SELECT COALESCE((SELECT purged_rows FROM retention_purges WHERE table_name=$1), 0)`, table).Scan(&n)
+	return n, err
+}
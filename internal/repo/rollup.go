@@ -0,0 +1,109 @@
+package repo
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"transfer-service/internal/service"
+)
+
+// rollupTables maps each rollup resolution to its table and the date_trunc
+// unit that produces its bucket keys.
+var rollupTables = map[time.Duration]struct{ table, unit string }{
+	time.Minute:    {"temperature_rollup_1m", "minute"},
+	time.Hour:      {"temperature_rollup_1h", "hour"},
+	24 * time.Hour: {"temperature_rollup_1d", "day"},
+}
+
+func rollupTable(resolution time.Duration) (string, string, error) {
+	t, ok := rollupTables[resolution]
+	if !ok {
+		return "", "", fmt.Errorf("no rollup table for resolution %s", resolution)
+	}
+	return t.table, t.unit, nil
+}
+
+// UpsertRollups folds one reading into every rollup table.
+func (r *PostgresRepo) UpsertRollups(ctx context.Context, rd service.TemperatureReading) error {
+	for _, res := range service.RollupResolutions {
+		table, unit, err := rollupTable(res)
+		if err != nil {
+			return err
+		}
+		q := `INSERT INTO ` + table + ` AS t (room_id, bucket, min_temp, max_temp, sum_temp, count)
+            VALUES ($1, date_trunc('` + unit + `', $2::timestamp), $3, $3, $3, 1)
+            ON CONFLICT (room_id, bucket) DO UPDATE SET
+                min_temp=LEAST(t.min_temp, EXCLUDED.min_temp),
+                max_temp=GREATEST(t.max_temp, EXCLUDED.max_temp),
+                sum_temp=t.sum_temp+EXCLUDED.sum_temp,
+                count=t.count+1`
+		if _, err := r.DB.ExecContext(ctx, q, rd.RoomID, rd.Ts, rd.Temp); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// BucketRollup aggregates rows of the rollup table at resolution into
+// epoch-aligned buckets; bucket must be a multiple of resolution.
+func (r *PostgresRepo) BucketRollup(ctx context.Context, roomID string, resolution time.Duration, from, to time.Time, bucket time.Duration) ([]service.TemperatureBucket, error) {
+	table, _, err := rollupTable(resolution)
+	if err != nil {
+		return nil, err
+	}
+	q := `SELECT 'epoch'::timestamp + floor(extract(epoch FROM bucket) / $4::bigint) * $4::bigint * interval '1 second' AS ts,
+            MIN(min_temp), SUM(sum_temp) / SUM(count), MAX(max_temp), SUM(count)
+        FROM ` + table + `
+        WHERE room_id=$1 AND bucket >= $2 AND bucket < $3
+        GROUP BY ts ORDER BY ts`
+	rows, err := r.DB.QueryContext(ctx, q, roomID, from, to, int64(bucket/time.Second))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	res := []service.TemperatureBucket{}
+	for rows.Next() {
+		var b service.TemperatureBucket
+		if err := rows.Scan(&b.Ts, &b.Min, &b.Avg, &b.Max, &b.Count); err != nil {
+			return nil, err
+		}
+		res = append(res, b)
+	}
+	return res, rows.Err()
+}
+
+func (r *PostgresRepo) OldestReadingAt(ctx context.Context) (*time.Time, error) {
+	var t *time.Time
+	if err := r.DB.QueryRowContext(ctx, `SELECT MIN(recorded_at) FROM temperature_readings`).Scan(&t); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// RebuildRollups recomputes every rollup bucket from since onwards out of
+// temperature_readings. Rollups before since are kept, so buckets whose raw
+// readings were purged survive. Writers are locked out for the duration.
+func (r *PostgresRepo) RebuildRollups(ctx context.Context, since time.Time) error {
+	for _, res := range service.RollupResolutions {
+		table, unit, err := rollupTable(res)
+		if err != nil {
+			return err
+		}
+		if _, err := r.DB.ExecContext(ctx, `LOCK TABLE `+table+` IN EXCLUSIVE MODE`); err != nil {
+			return err
+		}
+		start := `date_trunc('` + unit + `', $1::timestamp)`
+		if _, err := r.DB.ExecContext(ctx, `DELETE FROM `+table+` WHERE bucket >= `+start, since); err != nil {
+			return err
+		}
+		q := `INSERT INTO ` + table + ` (room_id, bucket, min_temp, max_temp, sum_temp, count)
+            SELECT room_id, date_trunc('` + unit + `', recorded_at), MIN(temp), MAX(temp), SUM(temp), COUNT(*)
+            FROM temperature_readings WHERE recorded_at >= ` + start + `
+            GROUP BY 1, 2`
+		if _, err := r.DB.ExecContext(ctx, q, since); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,126 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"transfer-service/internal/service"
+)
+
+const roomColumns = `id, name, type, critical_min, warning_min, warning_max, critical_max, hysteresis, excursion_delay_seconds,
+    report_interval_seconds, offline_after_seconds, trend_rise, trend_window_seconds, created_at, updated_at`
+
+func scanRoom(row rowScanner) (*service.Room, error) {
+	var rm service.Room
+	if err := row.Scan(&rm.ID, &rm.Name, &rm.Type, &rm.CriticalMin, &rm.WarningMin, &rm.WarningMax, &rm.CriticalMax, &rm.Hysteresis, &rm.ExcursionDelaySeconds,
+		&rm.ReportIntervalSeconds, &rm.OfflineAfterSeconds, &rm.TrendRise, &rm.TrendWindowSeconds, &rm.CreatedAt, &rm.UpdatedAt); err != nil {
+		return nil, err
+	}
+	return &rm, nil
+}
+
+func (r *PostgresRepo) CreateRoom(ctx context.Context, rm *service.Room) error {
+	q := `INSERT INTO rooms (` + roomColumns + `) VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11,$12,$13,$14,$15)`
+	_, err := r.DB.ExecContext(ctx, q, rm.ID, rm.Name, rm.Type, rm.CriticalMin, rm.WarningMin, rm.WarningMax, rm.CriticalMax, rm.Hysteresis, rm.ExcursionDelaySeconds,
+		rm.ReportIntervalSeconds, rm.OfflineAfterSeconds, rm.TrendRise, rm.TrendWindowSeconds, rm.CreatedAt, rm.UpdatedAt)
+	if isUniqueViolation(err) {
+		return service.ErrDuplicateRequest
+	}
+	return err
+}
+
+func (r *PostgresRepo) GetRoom(ctx context.Context, id string) (*service.Room, error) {
+	rm, err := scanRoom(r.DB.QueryRowContext(ctx, `SELECT `+roomColumns+` FROM rooms WHERE id=$1`, id))
+	if err == sql.ErrNoRows {
+		return nil, service.ErrNotFound
+	}
+	return rm, err
+}
+
+func (r *PostgresRepo) ListRooms(ctx context.Context) ([]service.Room, error) {
+	rows, err := r.DB.QueryContext(ctx, `SELECT `+roomColumns+` FROM rooms ORDER BY id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	res := []service.Room{}
+	for rows.Next() {
+		rm, err := scanRoom(rows)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, *rm)
+	}
+	return res, rows.Err()
+}
+
+func (r *PostgresRepo) UpdateRoom(ctx context.Context, rm *service.Room) error {
+	q := `UPDATE rooms SET name=$1, type=$2, critical_min=$3, warning_min=$4, warning_max=$5, critical_max=$6, hysteresis=$7, excursion_delay_seconds=$8,
+            report_interval_seconds=$9, offline_after_seconds=$10,
+            trend_rise=$11, trend_window_seconds=$12, updated_at=$13
+        WHERE id=$14`
+	res, err := r.DB.ExecContext(ctx, q, rm.Name, rm.Type, rm.CriticalMin, rm.WarningMin, rm.WarningMax, rm.CriticalMax, rm.Hysteresis, rm.ExcursionDelaySeconds,
+		rm.ReportIntervalSeconds, rm.OfflineAfterSeconds, rm.TrendRise, rm.TrendWindowSeconds, rm.UpdatedAt, rm.ID)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return service.ErrNotFound
+	}
+	return nil
+}
+
+func (r *PostgresRepo) TouchHeartbeat(ctx context.Context, rd service.TemperatureReading) error {
+	q := `INSERT INTO room_heartbeats (room_id, last_reading_at, last_temp, received_at) VALUES ($1,$2,$3,$4)
+        ON CONFLICT (room_id) DO UPDATE SET
+            last_temp=CASE WHEN EXCLUDED.last_reading_at >= room_heartbeats.last_reading_at THEN EXCLUDED.last_temp ELSE room_heartbeats.last_temp END,
+            last_reading_at=GREATEST(room_heartbeats.last_reading_at, EXCLUDED.last_reading_at),
+            received_at=EXCLUDED.received_at`
+	_, err := r.DB.ExecContext(ctx, q, rd.RoomID, rd.Ts, rd.Temp, time.Now().UTC())
+	return err
+}
+
+func (r *PostgresRepo) GetHeartbeat(ctx context.Context, roomID string) (*service.RoomHeartbeat, error) {
+	var hb service.RoomHeartbeat
+	q := `SELECT room_id, last_reading_at, last_temp, received_at FROM room_heartbeats WHERE room_id=$1`
+	err := r.DB.QueryRowContext(ctx, q, roomID).Scan(&hb.RoomID, &hb.LastReadingAt, &hb.LastTemp, &hb.ReceivedAt)
+	if err == sql.ErrNoRows {
+		return nil, service.ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &hb, nil
+}
+
+// ListOfflineCandidates returns rooms with offline detection enabled that
+// have not received a reading (or were created, if none) within their gap
+// at now and that have no active offline alert. The gap mirrors
+// Room.OfflineAfter; it is measured on received_at so sensor clock skew or
+// buffered readings cannot trigger or mask it.
+func (r *PostgresRepo) ListOfflineCandidates(ctx context.Context, now time.Time) ([]service.Room, error) {
+	gap := `(CASE WHEN offline_after_seconds > 0 THEN offline_after_seconds ELSE 3 * report_interval_seconds END)`
+	q := `SELECT ` + roomColumns + ` FROM rooms r
+        WHERE ` + gap + ` > 0
+        AND COALESCE((SELECT h.received_at FROM room_heartbeats h WHERE h.room_id = r.id), r.created_at)
+            < $1::timestamp - make_interval(secs => ` + gap + `)
+        AND NOT EXISTS (SELECT 1 FROM alerts a WHERE a.room_id = r.id AND a.condition = $2 AND a.cleared_at IS NULL)
+        ORDER BY id`
+	rows, err := r.DB.QueryContext(ctx, q, now, service.ConditionOffline)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	res := []service.Room{}
+	for rows.Next() {
+		rm, err := scanRoom(rows)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, *rm)
+	}
+	return res, rows.Err()
+}
@@ -0,0 +1,68 @@
+package repo
+
+import (
+	"context"
+	"time"
+
+	"transfer-service/internal/service"
+)
+
+func (r *PostgresRepo) IncrementRoomAlertCount(ctx context.Context, roomID, level string, at time.Time) error {
+	q := `INSERT INTO room_alert_counts (room_id, level, count, last_alert_at) VALUES ($1,$2,1,$3)
+        ON CONFLICT (room_id, level) DO UPDATE SET count=room_alert_counts.count+1,
+            last_alert_at=GREATEST(room_alert_counts.last_alert_at, EXCLUDED.last_alert_at)`
+	_, err := r.DB.ExecContext(ctx, q, roomID, level, at)
+	return err
+}
+
+func (r *PostgresRepo) ListRoomAlertCounts(ctx context.Context) ([]service.RoomAlertCount, error) {
+	rows, err := r.DB.QueryContext(ctx, `SELECT room_id, level, count, last_alert_at FROM room_alert_counts ORDER BY room_id, level`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	res := []service.RoomAlertCount{}
+	for rows.Next() {
+		var c service.RoomAlertCount
+		if err := rows.Scan(&c.RoomID, &c.Level, &c.Count, &c.LastAlertAt); err != nil {
+			return nil, err
+		}
+		res = append(res, c)
+	}
+	return res, rows.Err()
+}
+
+func (r *PostgresRepo) RecordOperatorMove(ctx context.Context, operatorID string, moveSeconds float64, dwellSeconds *float64, at time.Time) error {
+	q := `INSERT INTO operator_stats (operator_id, completed_moves, total_move_seconds, dwell_samples, total_dwell_seconds, last_completed_at)
+        VALUES ($1, 1, $2, CASE WHEN $3::float8 IS NULL THEN 0 ELSE 1 END, COALESCE($3::float8, 0), $4)
+        ON CONFLICT (operator_id) DO UPDATE SET
+            completed_moves=operator_stats.completed_moves+1,
+            total_move_seconds=operator_stats.total_move_seconds+EXCLUDED.total_move_seconds,
+            dwell_samples=operator_stats.dwell_samples+EXCLUDED.dwell_samples,
+            total_dwell_seconds=operator_stats.total_dwell_seconds+EXCLUDED.total_dwell_seconds,
+            last_completed_at=GREATEST(operator_stats.last_completed_at, EXCLUDED.last_completed_at)`
+	_, err := r.DB.ExecContext(ctx, q, operatorID, moveSeconds, dwellSeconds, at)
+	return err
+}
+
+func (r *PostgresRepo) ListOperatorStats(ctx context.Context) ([]service.OperatorStats, error) {
+	q := `SELECT operator_id, completed_moves,
+            total_move_seconds / GREATEST(completed_moves, 1),
+            total_dwell_seconds / GREATEST(dwell_samples, 1),
+            last_completed_at
+        FROM operator_stats ORDER BY operator_id`
+	rows, err := r.DB.QueryContext(ctx, q)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	res := []service.OperatorStats{}
+	for rows.Next() {
+		var s service.OperatorStats
+		if err := rows.Scan(&s.OperatorID, &s.CompletedMoves, &s.AvgMoveSeconds, &s.AvgDwellSeconds, &s.LastCompletedAt); err != nil {
+			return nil, err
+		}
+		res = append(res, s)
+	}
+	return res, rows.Err()
+}
@@ -0,0 +1,138 @@
+package service
+
+import (
+    "context"
+    "fmt"
+    "strings"
+    "time"
+
+    "github.com/rs/zerolog/log"
+)
+
+// Alert statuses track the operator workflow and are independent of
+// ClearedAt, which the engine sets when the excursion itself ends.
+const (
+    AlertOpen         = "open"
+    AlertAcknowledged = "acknowledged"
+    AlertResolved     = "resolved"
+)
+
+var alertTransitions = map[string][]string{
+    AlertOpen:         {AlertAcknowledged, AlertResolved},
+    AlertAcknowledged: {AlertResolved},
+}
+
+const (
+    defaultAlertPageSize = 100
+    maxAlertPageSize     = 500
+)
+
+// AlertFilter narrows GET /alerts. Empty fields are ignored; From/To apply
+// to created_at.
+type AlertFilter struct {
+    Status []string
+    RoomID string
+    From   *time.Time
+    To     *time.Time
+    Limit  int
+}
+
+type AcknowledgeAlertRequest struct {
+    AcknowledgedBy string `json:"acknowledged_by"`
+    Note           string `json:"note"`
+}
+
+// ResolveAlertRequest documents the corrective action taken for the
+// excursion; both fields are required for the HACCP record.
+type ResolveAlertRequest struct {
+    ResolvedBy       string `json:"resolved_by"`
+    CorrectiveAction string `json:"corrective_action"`
+}
+
+func validateAlertTransition(from, to string) error {
+    for _, s := range alertTransitions[from] {
+        if s == to { return nil }
+    }
+    return &TransitionError{From: from, To: to}
+}
+
+func (s *TemperatureService) ListAlerts(ctx context.Context, f AlertFilter) ([]Alert, error) {
+    for _, st := range f.Status {
+        if st != AlertOpen && st != AlertAcknowledged && st != AlertResolved {
+            return nil, fmt.Errorf("%w: unknown status %q", ErrInvalidRequest, st)
+        }
+    }
+    if f.Limit <= 0 { f.Limit = defaultAlertPageSize }
+    if f.Limit > maxAlertPageSize { f.Limit = maxAlertPageSize }
+    return s.repo.ListAlerts(ctx, f)
+}
+
+func (s *TemperatureService) GetAlert(ctx context.Context, id string) (*Alert, error) {
+    return s.repo.GetAlert(ctx, id)
+}
+
+func (s *TemperatureService) AcknowledgeAlert(ctx context.Context, id string, req AcknowledgeAlertRequest) (*Alert, error) {
+    if strings.TrimSpace(req.AcknowledgedBy) == "" {
+        return nil, fmt.Errorf("%w: acknowledged_by is required", ErrInvalidRequest)
+    }
+    var a *Alert
+    err := s.withLockedAlert(ctx, id, func(tx Repo, locked *Alert) error {
+        if err := validateAlertTransition(locked.Status, AlertAcknowledged); err != nil { return err }
+        now := time.Now().UTC()
+        locked.Status = AlertAcknowledged
+        locked.AcknowledgedBy = req.AcknowledgedBy
+        locked.AcknowledgeNote = req.Note
+        locked.AcknowledgedAt = &now
+        locked.UpdatedAt = now
+        if err := tx.UpdateAlert(ctx, locked); err != nil { return err }
+        evt := TemperatureAlertAcknowledged{AlertID:locked.ID, RoomID:locked.RoomID, AcknowledgedBy:req.AcknowledgedBy, Note:req.Note, Ts:now}
+        a = locked
+        return tx.InsertOutbox(ctx, AggregateTemperature, locked.ID, EventTemperatureAlertAcknowledged, evt)
+    })
+    if err != nil { return nil, err }
+    log.Info().Str("event",EventTemperatureAlertAcknowledged).Str("id",id).Str("by",req.AcknowledgedBy).Msg("alert acknowledged")
+    return a, nil
+}
+
+// ResolveAlert closes the alert with a corrective action. An alert whose
+// excursion is still active cannot be resolved: the next out-of-range
+// reading would raise it again straight away, so it is refused with
+// ErrConflict until the engine has cleared it.
+func (s *TemperatureService) ResolveAlert(ctx context.Context, id string, req ResolveAlertRequest) (*Alert, error) {
+    if strings.TrimSpace(req.ResolvedBy) == "" || strings.TrimSpace(req.CorrectiveAction) == "" {
+        return nil, fmt.Errorf("%w: resolved_by and corrective_action are required", ErrInvalidRequest)
+    }
+    var a *Alert
+    err := s.withLockedAlert(ctx, id, func(tx Repo, locked *Alert) error {
+        if err := validateAlertTransition(locked.Status, AlertResolved); err != nil { return err }
+        if locked.ClearedAt == nil {
+            return fmt.Errorf("%w: alert %s is still active, resolve it once the condition has cleared", ErrConflict, locked.ID)
+        }
+        now := time.Now().UTC()
+        locked.Status = AlertResolved
+        locked.ResolvedBy = req.ResolvedBy
+        locked.CorrectiveAction = req.CorrectiveAction
+        locked.ResolvedAt = &now
+        locked.UpdatedAt = now
+        if err := tx.UpdateAlert(ctx, locked); err != nil { return err }
+        evt := TemperatureAlertResolved{AlertID:locked.ID, RoomID:locked.RoomID, ResolvedBy:req.ResolvedBy, CorrectiveAction:req.CorrectiveAction, Ts:now}
+        a = locked
+        return tx.InsertOutbox(ctx, AggregateTemperature, locked.ID, EventTemperatureAlertResolved, evt)
+    })
+    if err != nil { return nil, err }
+    log.Info().Str("event",EventTemperatureAlertResolved).Str("id",id).Str("by",req.ResolvedBy).Msg("alert resolved")
+    return a, nil
+}
+
+// withLockedAlert takes the room's alert lock before the row lock, the same
+// order Ingest uses, so workflow updates never interleave with evaluation.
+func (s *TemperatureService) withLockedAlert(ctx context.Context, id string, fn func(tx Repo, a *Alert) error) error {
+    a, err := s.repo.GetAlert(ctx, id)
+    if err != nil { return err }
+    return s.repo.WithTx(ctx, func(tx Repo) error {
+        if err := tx.LockRoomAlerts(ctx, a.RoomID); err != nil { return err }
+        locked, err := tx.LockAlert(ctx, id)
+        if err != nil { return err }
+        return fn(tx, locked)
+    })
+}
@@ -0,0 +1,67 @@
+package service_test
+
+import (
+    "context"
+    "errors"
+    "testing"
+    "time"
+
+    "transfer-service/internal/service"
+)
+
+// alertRepo holds alerts in memory and records outbox topics. Other Repo
+// methods are not used by the alert workflow.
+type alertRepo struct {
+    service.Repo
+    alerts map[string]*service.Alert
+    topics []string
+}
+
+func (r *alertRepo) WithTx(ctx context.Context, fn func(service.Repo) error) error { return fn(r) }
+func (r *alertRepo) LockRoomAlerts(ctx context.Context, roomID string) error        { return nil }
+
+func (r *alertRepo) GetAlert(ctx context.Context, id string) (*service.Alert, error) {
+    a, ok := r.alerts[id]
+    if !ok { return nil, service.ErrNotFound }
+    cp := *a
+    return &cp, nil
+}
+
+func (r *alertRepo) LockAlert(ctx context.Context, id string) (*service.Alert, error) { return r.GetAlert(ctx, id) }
+
+func (r *alertRepo) UpdateAlert(ctx context.Context, a *service.Alert) error {
+    cp := *a
+    r.alerts[a.ID] = &cp
+    return nil
+}
+
+func (r *alertRepo) InsertOutbox(ctx context.Context, aggregateType, aggregateID, topic string, payload interface{}) error {
+    r.topics = append(r.topics, topic)
+    return nil
+}
+
+func TestResolveAlertRefusesActiveExcursion(t *testing.T) {
+    repo := &alertRepo{alerts: map[string]*service.Alert{
+        "a1": {ID: "a1", RoomID: "CR-01", Condition: service.ConditionHigh, Level: service.LevelWarning, Status: service.AlertAcknowledged},
+    }}
+    svc := service.NewTemperatureService(repo)
+    req := service.ResolveAlertRequest{ResolvedBy: "qa", CorrectiveAction: "door closed"}
+
+    if _, err := svc.ResolveAlert(context.Background(), "a1", req); !errors.Is(err, service.ErrConflict) {
+        t.Fatalf("resolve while active: err = %v, want ErrConflict", err)
+    }
+    if a := repo.alerts["a1"]; a.Status != service.AlertAcknowledged || a.ClearedAt != nil || len(repo.topics) != 0 {
+        t.Fatalf("refused resolve changed the alert: %+v, events %v", a, repo.topics)
+    }
+
+    cleared := time.Now().UTC()
+    repo.alerts["a1"].ClearedAt = &cleared
+    a, err := svc.ResolveAlert(context.Background(), "a1", req)
+    if err != nil { t.Fatal(err) }
+    if a.Status != service.AlertResolved || a.ResolvedBy != "qa" || a.ResolvedAt == nil {
+        t.Fatalf("resolved alert = %+v", a)
+    }
+    if len(repo.topics) != 1 || repo.topics[0] != service.EventTemperatureAlertResolved {
+        t.Fatalf("events = %v, want [%s]", repo.topics, service.EventTemperatureAlertResolved)
+    }
+}
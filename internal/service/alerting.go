@@ -0,0 +1,179 @@
+package service
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "math"
+    "time"
+
+    "github.com/google/uuid"
+)
+
+// alertChange is a raised or cleared alert, logged after commit.
+type alertChange struct {
+    event string
+    alert *Alert
+}
+
+// ExcursionWindow is the current run of consecutive stored readings beyond
+// a room's warning band in one direction. PeakTemp is the extreme in that
+// direction; Readings is 0 when the room is not in excursion.
+type ExcursionWindow struct {
+    Start    time.Time
+    End      time.Time
+    PeakTemp float64
+    Readings int
+}
+
+func (w *ExcursionWindow) Duration() time.Duration {
+    if w.Readings == 0 { return 0 }
+    return w.End.Sub(w.Start)
+}
+
+// evaluateBands runs the band rules for one reading. Each room has at most
+// one active alert per condition: a reading outside the warning band opens
+// one once the excursion window in temperature_readings has lasted the
+// room's excursion delay (so a short spike from a door opening is ignored),
+// or updates the active one (escalating warning to critical, never back),
+// and a reading back inside the band by the room's hysteresis clears it.
+// Readings in between leave the alert active. An escalation reopens an
+// acknowledged alert so the critical level gets attention again.
+func evaluateBands(ctx context.Context, tx Repo, room *Room, rd TemperatureReading) ([]alertChange, error) {
+    var changes []alertChange
+    now := time.Now().UTC()
+    for _, cond := range []string{ConditionHigh, ConditionLow} {
+        open, err := tx.GetOpenAlert(ctx, room.ID, cond)
+        if errors.Is(err, ErrNotFound) {
+            open, err = nil, nil
+        }
+        if err != nil { return nil, err }
+
+        if room.Condition(rd.Temp) == cond {
+            level := room.Level(rd.Temp)
+            if open == nil {
+                win, err := tx.ExcursionWindow(ctx, room.ID, cond, room.Threshold(cond), rd.Ts)
+                if err != nil { return nil, err }
+                if win.Readings == 0 {
+                    win = &ExcursionWindow{Start: rd.Ts, End: rd.Ts, PeakTemp: rd.Temp, Readings: 1}
+                }
+                if win.Duration() < room.ExcursionDelay() { continue }
+                // The excursion may have peaked past the critical limit
+                // during the delay even if the latest reading is milder.
+                level = room.Level(win.PeakTemp)
+                a := &Alert{ID: uuid.New().String(), RoomID: room.ID, Condition: cond, Level: level, Status: AlertOpen, Temp: rd.Temp, PeakTemp: win.PeakTemp, Message: bandMessage(room, level, win.PeakTemp), ExcursionStartedAt: win.Start, DurationSeconds: win.Duration().Seconds(), Created: now, UpdatedAt: now}
+                if err := tx.CreateAlert(ctx, a); err != nil { return nil, err }
+                if err := raiseAlert(ctx, tx, a); err != nil { return nil, err }
+                changes = append(changes, alertChange{EventTemperatureAlertRaised, a})
+                continue
+            }
+            escalated := open.Level == LevelWarning && level == LevelCritical
+            open.Temp = rd.Temp
+            if (cond == ConditionHigh && rd.Temp > open.PeakTemp) || (cond == ConditionLow && rd.Temp < open.PeakTemp) {
+                open.PeakTemp = rd.Temp
+            }
+            trackDuration(open, rd.Ts)
+            if escalated {
+                open.Level = level
+                open.Status = AlertOpen
+                open.Message = bandMessage(room, level, rd.Temp)
+            }
+            open.UpdatedAt = now
+            if err := tx.UpdateAlert(ctx, open); err != nil { return nil, err }
+            if escalated {
+                if err := raiseAlert(ctx, tx, open); err != nil { return nil, err }
+                changes = append(changes, alertChange{EventTemperatureAlertRaised, open})
+            }
+            continue
+        }
+
+        if open != nil && room.Recovered(cond, rd.Temp) {
+            open.Temp = rd.Temp
+            trackDuration(open, rd.Ts)
+            open.UpdatedAt = now
+            open.ClearedAt = &now
+            if err := tx.UpdateAlert(ctx, open); err != nil { return nil, err }
+            if err := clearAlert(ctx, tx, open); err != nil { return nil, err }
+            changes = append(changes, alertChange{EventTemperatureAlertCleared, open})
+        }
+    }
+    return changes, nil
+}
+
+// evaluateTrend runs the rate-of-change rule for one reading: a rise of
+// more than the room's TrendRise over the lowest reading in the trailing
+// TrendWindow raises a predictive "trend" warning, independent of the
+// band alerts, which clears once the rise has dropped back below TrendRise
+// by the room's hysteresis (or the rule is disabled).
+func evaluateTrend(ctx context.Context, tx Repo, room *Room, rd TemperatureReading) ([]alertChange, error) {
+    open, err := tx.GetOpenAlert(ctx, room.ID, ConditionTrend)
+    if errors.Is(err, ErrNotFound) {
+        open, err = nil, nil
+    }
+    if err != nil { return nil, err }
+    window := room.TrendWindow()
+    if window <= 0 && open == nil { return nil, nil }
+
+    var rise float64
+    if window > 0 {
+        min, n, err := tx.MinTempBetween(ctx, room.ID, rd.Ts.Add(-window), rd.Ts)
+        if err != nil { return nil, err }
+        if n > 0 { rise = rd.Temp - min }
+    }
+    now := time.Now().UTC()
+
+    if window > 0 && rise > room.TrendRise {
+        if open == nil {
+            msg := fmt.Sprintf("temp rose %.2f in %s (limit %.2f)", rise, window, room.TrendRise)
+            a := &Alert{ID: uuid.New().String(), RoomID: room.ID, Condition: ConditionTrend, Level: LevelWarning, Status: AlertOpen, Temp: rd.Temp, PeakTemp: rd.Temp, Message: msg, ExcursionStartedAt: rd.Ts, Created: now, UpdatedAt: now}
+            if err := tx.CreateAlert(ctx, a); err != nil { return nil, err }
+            if err := raiseAlert(ctx, tx, a); err != nil { return nil, err }
+            return []alertChange{{EventTemperatureAlertRaised, a}}, nil
+        }
+        open.Temp = rd.Temp
+        if rd.Temp > open.PeakTemp { open.PeakTemp = rd.Temp }
+        trackDuration(open, rd.Ts)
+        open.UpdatedAt = now
+        return nil, tx.UpdateAlert(ctx, open)
+    }
+
+    if open != nil && (window <= 0 || rise <= math.Max(0, room.TrendRise-room.Hysteresis)) {
+        open.Temp = rd.Temp
+        trackDuration(open, rd.Ts)
+        open.UpdatedAt = now
+        open.ClearedAt = &now
+        if err := tx.UpdateAlert(ctx, open); err != nil { return nil, err }
+        if err := clearAlert(ctx, tx, open); err != nil { return nil, err }
+        return []alertChange{{EventTemperatureAlertCleared, open}}, nil
+    }
+    return nil, nil
+}
+
+// trackDuration extends the excursion to the reading at ts; out-of-order
+// readings never shorten it.
+func trackDuration(a *Alert, ts time.Time) {
+    if d := ts.Sub(a.ExcursionStartedAt).Seconds(); d > a.DurationSeconds {
+        a.DurationSeconds = d
+    }
+}
+
+func raiseAlert(ctx context.Context, tx Repo, a *Alert) error {
+    evt := TemperatureAlertRaised{AlertID:a.ID, RoomID:a.RoomID, Condition:a.Condition, Temp:a.Temp, PeakTemp:a.PeakTemp, Level:a.Level, Message:a.Message, ExcursionStartedAt:a.ExcursionStartedAt, DurationSeconds:a.DurationSeconds, Ts:a.UpdatedAt}
+    return tx.InsertOutbox(ctx, AggregateTemperature, a.ID, EventTemperatureAlertRaised, evt)
+}
+
+// clearAlert emits the cleared event for a, whose ClearedAt is already set.
+func clearAlert(ctx context.Context, tx Repo, a *Alert) error {
+    if a.Condition == ConditionOffline {
+        evt := SensorOfflineCleared{AlertID:a.ID, RoomID:a.RoomID, OfflineSince:a.ExcursionStartedAt, DurationSeconds:a.DurationSeconds, Ts:*a.ClearedAt}
+        return tx.InsertOutbox(ctx, AggregateTemperature, a.ID, EventSensorOfflineCleared, evt)
+    }
+    evt := TemperatureAlertCleared{AlertID:a.ID, RoomID:a.RoomID, Condition:a.Condition, Level:a.Level, Temp:a.Temp, PeakTemp:a.PeakTemp, ExcursionStartedAt:a.ExcursionStartedAt, DurationSeconds:a.DurationSeconds, RaisedAt:a.Created, Ts:*a.ClearedAt}
+    return tx.InsertOutbox(ctx, AggregateTemperature, a.ID, EventTemperatureAlertCleared, evt)
+}
+
+func bandMessage(room *Room, level string, temp float64) string {
+    lo, hi := room.WarningMin, room.WarningMax
+    if level == LevelCritical { lo, hi = room.CriticalMin, room.CriticalMax }
+    return fmt.Sprintf("temp %.2f out of %s band (%.2f..%.2f)", temp, level, lo, hi)
+}
@@ -0,0 +1,175 @@
+package service
+
+import (
+    "context"
+    "testing"
+    "time"
+)
+
+// bandRepo keeps the open alert per condition in memory and records outbox
+// topics. ExcursionWindow reports window when set, otherwise no stored
+// excursion. Other Repo methods are not used by evaluateBands.
+type bandRepo struct {
+    Repo
+    open   map[string]*Alert
+    window *ExcursionWindow
+    topics []string
+}
+
+func newBandRepo() *bandRepo { return &bandRepo{open: map[string]*Alert{}} }
+
+func (r *bandRepo) GetOpenAlert(ctx context.Context, roomID, condition string) (*Alert, error) {
+    a, ok := r.open[condition]
+    if !ok { return nil, ErrNotFound }
+    cp := *a
+    return &cp, nil
+}
+
+func (r *bandRepo) ExcursionWindow(ctx context.Context, roomID, condition string, threshold float64, at time.Time) (*ExcursionWindow, error) {
+    if r.window != nil { return r.window, nil }
+    return &ExcursionWindow{}, nil
+}
+
+func (r *bandRepo) CreateAlert(ctx context.Context, a *Alert) error {
+    cp := *a
+    r.open[a.Condition] = &cp
+    return nil
+}
+
+func (r *bandRepo) UpdateAlert(ctx context.Context, a *Alert) error {
+    cp := *a
+    if a.ClearedAt != nil {
+        delete(r.open, a.Condition)
+        return nil
+    }
+    r.open[a.Condition] = &cp
+    return nil
+}
+
+func (r *bandRepo) InsertOutbox(ctx context.Context, aggregateType, aggregateID, topic string, payload interface{}) error {
+    r.topics = append(r.topics, topic)
+    return nil
+}
+
+// testRoom: critical below -2 or above 6, warning below 0 or above 4,
+// clearing 0.5 back inside the warning band.
+func testRoom() *Room {
+    return &Room{ID: "CR-01", CriticalMin: -2, WarningMin: 0, WarningMax: 4, CriticalMax: 6, Hysteresis: 0.5}
+}
+
+func TestRoomBandEdges(t *testing.T) {
+    room := testRoom()
+    tests := []struct {
+        temp      float64
+        level     string
+        condition string
+    }{
+        {2, "", ""},
+        {4, "", ""},
+        {4.01, LevelWarning, ConditionHigh},
+        {6, LevelWarning, ConditionHigh},
+        {6.01, LevelCritical, ConditionHigh},
+        {0, "", ""},
+        {-0.01, LevelWarning, ConditionLow},
+        {-2, LevelWarning, ConditionLow},
+        {-2.01, LevelCritical, ConditionLow},
+    }
+    for _, tt := range tests {
+        if got := room.Level(tt.temp); got != tt.level {
+            t.Errorf("Level(%v) = %q, want %q", tt.temp, got, tt.level)
+        }
+        if got := room.Condition(tt.temp); got != tt.condition {
+            t.Errorf("Condition(%v) = %q, want %q", tt.temp, got, tt.condition)
+        }
+    }
+}
+
+func TestRoomRecovered(t *testing.T) {
+    room := testRoom()
+    tests := []struct {
+        condition string
+        temp      float64
+        want      bool
+    }{
+        {ConditionHigh, 4, false},
+        {ConditionHigh, 3.6, false},
+        {ConditionHigh, 3.5, true},
+        {ConditionHigh, 1, true},
+        {ConditionLow, 0, false},
+        {ConditionLow, 0.4, false},
+        {ConditionLow, 0.5, true},
+    }
+    for _, tt := range tests {
+        if got := room.Recovered(tt.condition, tt.temp); got != tt.want {
+            t.Errorf("Recovered(%s, %v) = %v, want %v", tt.condition, tt.temp, got, tt.want)
+        }
+    }
+}
+
+func evaluate(t *testing.T, repo *bandRepo, room *Room, temp float64) []alertChange {
+    t.Helper()
+    changes, err := evaluateBands(context.Background(), repo, room, TemperatureReading{RoomID: room.ID, Temp: temp, Ts: time.Now().UTC()})
+    if err != nil { t.Fatal(err) }
+    return changes
+}
+
+func TestEvaluateBandsHysteresis(t *testing.T) {
+    room := testRoom()
+    repo := newBandRepo()
+
+    if ch := evaluate(t, repo, room, 4.5); len(ch) != 1 || ch[0].event != EventTemperatureAlertRaised || ch[0].alert.Level != LevelWarning {
+        t.Fatalf("4.5: changes %+v, want a raised warning", ch)
+    }
+    // Back inside the warning band but not past the hysteresis margin.
+    for _, temp := range []float64{4, 3.8, 3.51} {
+        if ch := evaluate(t, repo, room, temp); len(ch) != 0 {
+            t.Fatalf("%v: changes %+v, want none inside the hysteresis band", temp, ch)
+        }
+        if repo.open[ConditionHigh] == nil { t.Fatalf("%v cleared the alert inside the hysteresis band", temp) }
+    }
+    if ch := evaluate(t, repo, room, 3.5); len(ch) != 1 || ch[0].event != EventTemperatureAlertCleared {
+        t.Fatalf("3.5: changes %+v, want the alert cleared", ch)
+    }
+    if repo.open[ConditionHigh] != nil { t.Fatal("alert still open after recovery") }
+}
+
+func TestEvaluateBandsEscalation(t *testing.T) {
+    room := testRoom()
+    repo := newBandRepo()
+
+    evaluate(t, repo, room, -1)
+    repo.open[ConditionLow].Status = AlertAcknowledged
+
+    ch := evaluate(t, repo, room, -3)
+    if len(ch) != 1 || ch[0].event != EventTemperatureAlertRaised {
+        t.Fatalf("-3: changes %+v, want a raised escalation", ch)
+    }
+    a := repo.open[ConditionLow]
+    if a.Level != LevelCritical || a.Status != AlertOpen || a.PeakTemp != -3 {
+        t.Fatalf("escalated alert = %+v, want open critical with peak -3", a)
+    }
+
+    // A milder reading never downgrades the level.
+    if ch := evaluate(t, repo, room, -1); len(ch) != 0 { t.Fatalf("-1: changes %+v, want none", ch) }
+    if a := repo.open[ConditionLow]; a.Level != LevelCritical || a.Temp != -1 || a.PeakTemp != -3 {
+        t.Fatalf("after a milder reading = %+v", a)
+    }
+    if n := len(repo.topics); n != 2 { t.Fatalf("outbox events %v, want raise and escalation only", repo.topics) }
+}
+
+func TestEvaluateBandsExcursionDelay(t *testing.T) {
+    room := testRoom()
+    room.ExcursionDelaySeconds = 300
+    repo := newBandRepo()
+    now := time.Now().UTC()
+
+    repo.window = &ExcursionWindow{Start: now.Add(-time.Minute), End: now, PeakTemp: 7, Readings: 3}
+    if ch := evaluate(t, repo, room, 5); len(ch) != 0 { t.Fatalf("changes %+v before the excursion delay", ch) }
+
+    // The excursion peaked past the critical limit during the delay.
+    repo.window = &ExcursionWindow{Start: now.Add(-5 * time.Minute), End: now, PeakTemp: 7, Readings: 6}
+    ch := evaluate(t, repo, room, 5)
+    if len(ch) != 1 || ch[0].alert.Level != LevelCritical || ch[0].alert.PeakTemp != 7 {
+        t.Fatalf("changes %+v, want a critical alert at peak 7", ch)
+    }
+}
@@ -2,21 +2,35 @@ package service
 
 import (
     "context"
-    "os"
 )
 
 type CombinedService struct {
     Transfer    *TransferService
+    Location    *LocationService
+    Pallet      *PalletService
     Temperature *TemperatureService
+    Room        *RoomService
+    Idempotency *IdempotencyService
+    Relay       *OutboxRelay
+    Inventory   *InventoryService
+    Stats       *StatsService
+    Projections *ProjectionRunner
+    Retention   *RetentionPurger
     repo        Repo
 }
 
-func NewCombinedService(t *TransferService, temp *TemperatureService, r Repo) *CombinedService {
-    return &CombinedService{Transfer: t, Temperature: temp, repo: r}
+func NewCombinedService(t *TransferService, temp *TemperatureService, relay *OutboxRelay, r Repo) *CombinedService {
+    projections := DefaultProjections(r)
+    return &CombinedService{Transfer: t, Location: NewLocationService(r), Pallet: NewPalletService(r), Temperature: temp, Room: NewRoomService(r), Idempotency: NewIdempotencyService(r), Relay: relay, Inventory: NewInventoryService(r), Stats: NewStatsService(r), Projections: projections, Retention: NewRetentionPurger(r, projections.Names()...), repo: r}
 }
 
-func (s *CombinedService) FlushOutbox(ctx context.Context) error {
-    outdir := "outbox_events"
-    if err := os.MkdirAll(outdir, 0o755); err != nil { return err }
-    return s.repo.FlushOutboxAndMark(ctx, outdir)
+// DefaultProjections registers every read model built from the outbox.
+func DefaultProjections(r Repo) *ProjectionRunner {
+    return NewProjectionRunner(r, InventoryProjection{}, RoomAlertsProjection{}, OperatorStatsProjection{})
+}
+
+// FlushOutbox drains the outbox immediately instead of waiting for the next
+// relay tick. Kept for local development.
+func (s *CombinedService) FlushOutbox(ctx context.Context) (int, error) {
+    return s.Relay.Drain(ctx)
 }
@@ -0,0 +1,36 @@
+package service_test
+
+import (
+    "context"
+    "database/sql"
+    "os"
+    "testing"
+
+    "github.com/google/uuid"
+
+    "transfer-service/internal/repo"
+    "transfer-service/internal/service"
+)
+
+// testRepo connects to the database in TEST_DATABASE_URL and migrates it.
+// Tests that need PostgreSQL are skipped when it is not set.
+func testRepo(t *testing.T) *repo.PostgresRepo {
+    t.Helper()
+    dsn := os.Getenv("TEST_DATABASE_URL")
+    if dsn == "" { t.Skip("TEST_DATABASE_URL not set") }
+    db, err := sql.Open("postgres", dsn)
+    if err != nil { t.Fatalf("open: %v", err) }
+    t.Cleanup(func() { db.Close() })
+    if err := repo.AutoMigrate(db); err != nil { t.Fatalf("migrate: %v", err) }
+    return repo.NewPostgresRepo(db)
+}
+
+// uniqueID returns prefix with a random suffix so tests can share a database.
+func uniqueID(prefix string) string { return prefix + "-" + uuid.New().String()[:8] }
+
+func createLocation(t *testing.T, r service.Repo, capacity int) string {
+    t.Helper()
+    loc, err := service.NewLocationService(r).Create(context.Background(), service.LocationRequest{Code: uniqueID("LOC"), Capacity: capacity})
+    if err != nil { t.Fatalf("create location: %v", err) }
+    return loc.Code
+}
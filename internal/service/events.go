@@ -0,0 +1,148 @@
+package service
+
+import "time"
+
+// Event types, also used as outbox topics and CloudEvents "type".
+const (
+    EventTransferCreated   = "transfer.created"
+    EventTransferAccepted  = "transfer.accepted"
+    EventTransferStarted   = "transfer.started"
+    EventTransferCompleted = "transfer.completed"
+    EventTransferRejected  = "transfer.rejected"
+    EventTransferCancelled = "transfer.cancelled"
+
+    EventTemperatureAlertRaised       = "temperature.alert.raised"
+    EventTemperatureAlertCleared      = "temperature.alert.cleared"
+    EventTemperatureAlertAcknowledged = "temperature.alert.acknowledged"
+    EventTemperatureAlertResolved     = "temperature.alert.resolved"
+    EventSensorOffline                = "temperature.sensor.offline"
+    EventSensorOfflineCleared         = "temperature.sensor.offline.cleared"
+
+    // EventTemperatureAlert is the topic used before alerts had a
+    // lifecycle; old outbox rows still carry it.
+    EventTemperatureAlert = "temperature.alert"
+)
+
+// Aggregate types stored on outbox rows; the CloudEvents "subject" is the
+// aggregate ID.
+const (
+    AggregateTransfer    = "transfer"
+    AggregateTemperature = "temperature"
+)
+
+// Event payloads. These are the CloudEvents "data" of each type; all
+// timestamps are UTC.
+
+type TransferCreated struct {
+    TransferID  string    `json:"transfer_id"`
+    PalletID    string    `json:"pallet_id"`
+    From        string    `json:"from"`
+    To          string    `json:"to"`
+    Status      string    `json:"status"`
+    RequestedBy string    `json:"requested_by"`
+    Ts          time.Time `json:"ts"`
+}
+
+type TransferAccepted struct {
+    TransferID string    `json:"transfer_id"`
+    ApprovedBy string    `json:"approved_by"`
+    Ts         time.Time `json:"ts"`
+}
+
+type TransferStarted struct {
+    TransferID  string    `json:"transfer_id"`
+    PalletID    string    `json:"pallet_id"`
+    OperatorID  string    `json:"operator_id"`
+    EquipmentID string    `json:"equipment_id"`
+    Ts          time.Time `json:"ts"`
+}
+
+type TransferCompleted struct {
+    TransferID          string    `json:"transfer_id"`
+    PalletID            string    `json:"pallet_id"`
+    From                string    `json:"from"`
+    To                  string    `json:"to"`
+    ProcessedBy         string    `json:"processed_by"`
+    EquipmentID         string    `json:"equipment_id,omitempty"`
+    MoveDurationSeconds float64   `json:"move_duration_seconds"`
+    DwellSeconds        *float64  `json:"dwell_seconds,omitempty"`
+    Ts                  time.Time `json:"ts"`
+}
+
+type TransferRejected struct {
+    TransferID string    `json:"transfer_id"`
+    PalletID   string    `json:"pallet_id"`
+    To         string    `json:"to"`
+    RejectedBy string    `json:"rejected_by"`
+    Reason     string    `json:"reason"`
+    Ts         time.Time `json:"ts"`
+}
+
+type TransferCancelled struct {
+    TransferID  string    `json:"transfer_id"`
+    PalletID    string    `json:"pallet_id"`
+    To          string    `json:"to"`
+    CancelledBy string    `json:"cancelled_by"`
+    Reason      string    `json:"reason,omitempty"`
+    Ts          time.Time `json:"ts"`
+}
+
+// TemperatureAlertRaised is emitted when an alert opens and again when an
+// open alert escalates from warning to critical.
+type TemperatureAlertRaised struct {
+    AlertID            string    `json:"alert_id"`
+    RoomID             string    `json:"room_id"`
+    Condition          string    `json:"condition"`
+    Temp               float64   `json:"temp"`
+    PeakTemp           float64   `json:"peak_temp"`
+    Level              string    `json:"level"`
+    Message            string    `json:"message"`
+    ExcursionStartedAt time.Time `json:"excursion_started_at"`
+    DurationSeconds    float64   `json:"duration_seconds"`
+    Ts                 time.Time `json:"ts"`
+}
+
+type TemperatureAlertCleared struct {
+    AlertID            string    `json:"alert_id"`
+    RoomID             string    `json:"room_id"`
+    Condition          string    `json:"condition"`
+    Level              string    `json:"level"`
+    Temp               float64   `json:"temp"`
+    PeakTemp           float64   `json:"peak_temp"`
+    ExcursionStartedAt time.Time `json:"excursion_started_at"`
+    DurationSeconds    float64   `json:"duration_seconds"`
+    RaisedAt           time.Time `json:"raised_at"`
+    Ts                 time.Time `json:"ts"`
+}
+
+type TemperatureAlertAcknowledged struct {
+    AlertID        string    `json:"alert_id"`
+    RoomID         string    `json:"room_id"`
+    AcknowledgedBy string    `json:"acknowledged_by"`
+    Note           string    `json:"note,omitempty"`
+    Ts             time.Time `json:"ts"`
+}
+
+type TemperatureAlertResolved struct {
+    AlertID          string    `json:"alert_id"`
+    RoomID           string    `json:"room_id"`
+    ResolvedBy       string    `json:"resolved_by"`
+    CorrectiveAction string    `json:"corrective_action"`
+    Ts               time.Time `json:"ts"`
+}
+
+type SensorOffline struct {
+    AlertID       string    `json:"alert_id"`
+    RoomID        string    `json:"room_id"`
+    LastReadingAt time.Time `json:"last_reading_at"`
+    GapSeconds    float64   `json:"gap_seconds"`
+    Ts            time.Time `json:"ts"`
+}
+
+type SensorOfflineCleared struct {
+    AlertID         string    `json:"alert_id"`
+    RoomID          string    `json:"room_id"`
+    OfflineSince    time.Time `json:"offline_since"`
+    DurationSeconds float64   `json:"duration_seconds"`
+    Ts              time.Time `json:"ts"`
+}
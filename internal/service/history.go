@@ -0,0 +1,155 @@
+package service
+
+import (
+    "context"
+    "fmt"
+    "strconv"
+    "strings"
+    "time"
+
+    "github.com/rs/zerolog/log"
+)
+
+const (
+    defaultHistoryRange = 24 * time.Hour
+    maxHistoryPoints    = 10000
+    // maxBucketDays keeps a "<n>d" bucket within time.Duration.
+    maxBucketDays       = 36500
+)
+
+// RollupResolutions are the maintained rollup granularities, coarsest
+// first. Every reading is folded into each of them on ingest.
+var RollupResolutions = []time.Duration{24 * time.Hour, time.Hour, time.Minute}
+
+// HistoryQuery selects readings of one room in [From, To). A zero Bucket
+// returns raw readings; otherwise readings are aggregated per bucket,
+// aligned to the Unix epoch.
+type HistoryQuery struct {
+    RoomID string
+    From   time.Time
+    To     time.Time
+    Bucket time.Duration
+}
+
+type TemperatureBucket struct {
+    Ts    time.Time `json:"ts"`
+    Min   float64   `json:"min"`
+    Avg   float64   `json:"avg"`
+    Max   float64   `json:"max"`
+    Count int       `json:"count"`
+}
+
+// TemperatureHistory holds either Readings (raw) or Buckets. Source is the
+// table the data came from: "raw", "rollup_1m", "rollup_1h" or "rollup_1d".
+type TemperatureHistory struct {
+    RoomID   string               `json:"room_id"`
+    From     time.Time            `json:"from"`
+    To       time.Time            `json:"to"`
+    Bucket   string               `json:"bucket,omitempty"`
+    Source   string               `json:"source"`
+    Readings []TemperatureReading `json:"readings,omitempty"`
+    Buckets  []TemperatureBucket  `json:"buckets,omitempty"`
+}
+
+// ParseBucket parses a bucket size such as "30s", "5m", "1h" or "1d".
+func ParseBucket(v string) (time.Duration, error) {
+    if v == "" { return 0, nil }
+    if strings.HasSuffix(v, "d") {
+        n, err := strconv.Atoi(strings.TrimSuffix(v, "d"))
+        if err != nil || n <= 0 || n > maxBucketDays { return 0, fmt.Errorf("%w: invalid bucket %q", ErrInvalidRequest, v) }
+        return time.Duration(n) * 24 * time.Hour, nil
+    }
+    d, err := time.ParseDuration(v)
+    if err != nil || d < time.Second || d%time.Second != 0 {
+        return 0, fmt.Errorf("%w: invalid bucket %q", ErrInvalidRequest, v)
+    }
+    return d, nil
+}
+
+func rollupSource(res time.Duration) string {
+    switch res {
+    case time.Minute:
+        return "rollup_1m"
+    case time.Hour:
+        return "rollup_1h"
+    }
+    return "rollup_1d"
+}
+
+// alignDown rounds t down to a multiple of d since the Unix epoch.
+func alignDown(t time.Time, d time.Duration) time.Time {
+    s := int64(d / time.Second)
+    u := t.Unix()
+    u -= ((u % s) + s) % s
+    return time.Unix(u, 0).UTC()
+}
+
+// History returns the readings of a room. To defaults to now and From to 24h
+// before To. Bucketed queries widen [From, To) to whole buckets and read the
+// coarsest rollup whose resolution divides the bucket, falling back to raw
+// readings for buckets finer than a minute. Raw queries and bucket counts
+// are capped at maxHistoryPoints so a dashboard asking for a month of raw
+// data gets a 400 telling it to bucket instead of millions of rows.
+func (s *TemperatureService) History(ctx context.Context, q HistoryQuery) (*TemperatureHistory, error) {
+    if q.To.IsZero() { q.To = time.Now().UTC() }
+    if q.From.IsZero() { q.From = q.To.Add(-defaultHistoryRange) }
+    if !q.From.Before(q.To) {
+        return nil, fmt.Errorf("%w: from must be before to", ErrInvalidRequest)
+    }
+    h := &TemperatureHistory{RoomID: q.RoomID, From: q.From.UTC(), To: q.To.UTC(), Source: "raw"}
+    if q.Bucket == 0 {
+        readings, err := s.repo.ListReadings(ctx, q.RoomID, h.From, h.To, maxHistoryPoints+1)
+        if err != nil { return nil, err }
+        if len(readings) > maxHistoryPoints {
+            return nil, fmt.Errorf("%w: more than %d readings in range, use bucket", ErrInvalidRequest, maxHistoryPoints)
+        }
+        h.Readings = readings
+        return h, nil
+    }
+
+    h.From = alignDown(h.From, q.Bucket)
+    if end := alignDown(h.To, q.Bucket); end.Before(h.To) {
+        h.To = end.Add(q.Bucket)
+    }
+    if h.To.Sub(h.From)/q.Bucket > maxHistoryPoints {
+        return nil, fmt.Errorf("%w: more than %d buckets in range, use a larger bucket", ErrInvalidRequest, maxHistoryPoints)
+    }
+    h.Bucket = q.Bucket.String()
+
+    var buckets []TemperatureBucket
+    var err error
+    for _, res := range RollupResolutions {
+        if q.Bucket%res != 0 { continue }
+        h.Source = rollupSource(res)
+        buckets, err = s.repo.BucketRollup(ctx, q.RoomID, res, h.From, h.To, q.Bucket)
+        break
+    }
+    if h.Source == "raw" {
+        buckets, err = s.repo.BucketReadings(ctx, q.RoomID, h.From, h.To, q.Bucket)
+    }
+    if err != nil { return nil, err }
+    h.Buckets = buckets
+    return h, nil
+}
+
+// RebuildRollups recomputes rollups from raw readings recorded since since,
+// or since the oldest stored reading when since is zero. Rollup buckets
+// older than that are left alone, which keeps history whose raw readings
+// have already been purged.
+func (s *TemperatureService) RebuildRollups(ctx context.Context, since time.Time) error {
+    if since.IsZero() {
+        oldest, err := s.repo.OldestReadingAt(ctx)
+        if err != nil { return err }
+        if oldest == nil {
+            log.Info().Msg("no readings, rollups unchanged")
+            return nil
+        }
+        since = *oldest
+    }
+    err := s.repo.WithTx(ctx, func(tx Repo) error {
+        return tx.RebuildRollups(ctx, since)
+    })
+    if err != nil { return err }
+    log.Info().Time("since", since).Msg("rollups rebuilt")
+    return nil
+}
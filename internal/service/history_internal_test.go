@@ -0,0 +1,70 @@
+package service
+
+import (
+    "errors"
+    "testing"
+    "time"
+)
+
+func TestParseBucket(t *testing.T) {
+    valid := map[string]time.Duration{
+        "":    0,
+        "1s":  time.Second,
+        "1m":  time.Minute,
+        "15m": 15 * time.Minute,
+        "1h":  time.Hour,
+        "1d":  24 * time.Hour,
+        "7d":  7 * 24 * time.Hour,
+    }
+    for in, want := range valid {
+        got, err := ParseBucket(in)
+        if err != nil || got != want {
+            t.Errorf("ParseBucket(%q) = %s, %v; want %s", in, got, err, want)
+        }
+    }
+    for _, in := range []string{"0s", "0d", "-1m", "-1d", "500ms", "1.5s", "d", "1.5d", "xd", "abc", "1w", "1000000d"} {
+        if _, err := ParseBucket(in); !errors.Is(err, ErrInvalidRequest) {
+            t.Errorf("ParseBucket(%q) error = %v, want ErrInvalidRequest", in, err)
+        }
+    }
+}
+
+func TestAlignDown(t *testing.T) {
+    at := func(s string) time.Time {
+        tm, err := time.Parse(time.RFC3339Nano, s)
+        if err != nil { t.Fatal(err) }
+        return tm
+    }
+    tests := []struct {
+        in     string
+        bucket time.Duration
+        want   string
+    }{
+        {"2026-03-01T10:17:42.5Z", time.Minute, "2026-03-01T10:17:00Z"},
+        {"2026-03-01T10:17:00Z", time.Minute, "2026-03-01T10:17:00Z"},
+        {"2026-03-01T10:17:59.999Z", time.Minute, "2026-03-01T10:17:00Z"},
+        {"2026-03-01T10:59:59Z", time.Hour, "2026-03-01T10:00:00Z"},
+        {"2026-03-01T11:00:00Z", time.Hour, "2026-03-01T11:00:00Z"},
+        {"2026-03-01T23:59:59Z", 24 * time.Hour, "2026-03-01T00:00:00Z"},
+        {"2026-03-02T00:00:00Z", 24 * time.Hour, "2026-03-02T00:00:00Z"},
+        // Buckets are aligned in UTC whatever the input zone.
+        {"2026-03-02T05:00:00+07:00", 24 * time.Hour, "2026-03-01T00:00:00Z"},
+        {"2026-03-01T10:17:42Z", 15 * time.Minute, "2026-03-01T10:15:00Z"},
+        // Before the epoch, rounding still goes down.
+        {"1969-12-31T23:59:30Z", time.Minute, "1969-12-31T23:59:00Z"},
+    }
+    for _, tt := range tests {
+        got := alignDown(at(tt.in), tt.bucket)
+        if want := at(tt.want); !got.Equal(want) || got.Location() != time.UTC {
+            t.Errorf("alignDown(%s, %s) = %s, want %s", tt.in, tt.bucket, got, want)
+        }
+    }
+}
+
+func TestRollupSource(t *testing.T) {
+    for res, want := range map[time.Duration]string{time.Minute: "rollup_1m", time.Hour: "rollup_1h", 24 * time.Hour: "rollup_1d"} {
+        if got := rollupSource(res); got != want {
+            t.Errorf("rollupSource(%s) = %s, want %s", res, got, want)
+        }
+    }
+}
@@ -0,0 +1,119 @@
+package service
+
+import (
+    "context"
+    "crypto/sha256"
+    "encoding/hex"
+    "errors"
+    "os"
+    "time"
+
+    "github.com/google/uuid"
+    "github.com/rs/zerolog/log"
+)
+
+var (
+    ErrIdempotencyMismatch   = errors.New("idempotency key reused with a different request")
+    ErrIdempotencyInProgress = errors.New("request with this idempotency key is still in progress")
+    ErrDuplicateRequest      = errors.New("duplicate request")
+    ErrIdempotencyLeaseLost  = errors.New("idempotency reservation was taken over by another request")
+)
+
+// IdempotencyRecord is the stored outcome of a request made with an
+// Idempotency-Key. StatusCode is 0 while the original request is in flight;
+// such a reservation is only honoured until LeaseExpiresAt, after which a
+// retry of the same request may take it over.
+type IdempotencyRecord struct {
+    Key            string
+    RequestHash    string
+    StatusCode     int
+    ResponseBody   []byte
+    CreatedAt      time.Time
+    ExpiresAt      time.Time
+    LeaseExpiresAt time.Time
+}
+
+type IdempotencyService struct {
+    repo          Repo
+    ttl           time.Duration
+    lease         time.Duration
+    purgeInterval time.Duration
+}
+
+func NewIdempotencyService(r Repo) *IdempotencyService {
+    ttl := 24 * time.Hour
+    if v := os.Getenv("IDEMPOTENCY_TTL"); v != "" {
+        if d, err := time.ParseDuration(v); err == nil && d > 0 { ttl = d }
+    }
+    lease := time.Minute
+    if v := os.Getenv("IDEMPOTENCY_LEASE"); v != "" {
+        if d, err := time.ParseDuration(v); err == nil && d > 0 { lease = d }
+    }
+    purge := time.Hour
+    if v := os.Getenv("IDEMPOTENCY_PURGE_INTERVAL"); v != "" {
+        if d, err := time.ParseDuration(v); err == nil && d > 0 { purge = d }
+    }
+    return &IdempotencyService{repo: r, ttl: ttl, lease: lease, purgeInterval: purge}
+}
+
+// HashRequest fingerprints a request so a reused key can be told apart from
+// a genuine retry.
+func HashRequest(method, path string, body []byte) string {
+    h := sha256.New()
+    h.Write([]byte(method))
+    h.Write([]byte{0})
+    h.Write([]byte(path))
+    h.Write([]byte{0})
+    h.Write(body)
+    return hex.EncodeToString(h.Sum(nil))
+}
+
+// Begin reserves key for a new request and returns the token that owns the
+// reservation. It returns a non-nil record instead when the request was
+// already completed and its response should be replayed.
+func (s *IdempotencyService) Begin(ctx context.Context, key, requestHash string) (*IdempotencyRecord, string, error) {
+    now := time.Now().UTC()
+    token := uuid.New().String()
+    rec, reserved, err := s.repo.ReserveIdempotencyKey(ctx, key, requestHash, token, now, now.Add(s.lease), now.Add(s.ttl))
+    if err != nil { return nil, "", err }
+    if reserved { return nil, token, nil }
+    if rec.RequestHash != requestHash { return nil, "", ErrIdempotencyMismatch }
+    if rec.StatusCode == 0 { return nil, "", ErrIdempotencyInProgress }
+    return rec, "", nil
+}
+
+// Complete stores the response for the reservation owned by token so
+// identical retries can replay it.
+func (s *IdempotencyService) Complete(ctx context.Context, key, token string, statusCode int, body []byte) error {
+    return s.repo.SaveIdempotencyResponse(ctx, key, token, statusCode, body)
+}
+
+// Abort drops the reservation owned by token so the client may retry after
+// a server error. A reservation another request has taken over since is kept.
+func (s *IdempotencyService) Abort(ctx context.Context, key, token string) error {
+    return s.repo.DeleteIdempotencyKey(ctx, key, token)
+}
+
+// PurgeExpired deletes keys past their TTL and returns how many were removed.
+func (s *IdempotencyService) PurgeExpired(ctx context.Context) (int64, error) {
+    return s.repo.PurgeIdempotencyKeys(ctx, time.Now().UTC())
+}
+
+// RunPurger purges expired keys every purgeInterval until ctx is cancelled.
+func (s *IdempotencyService) RunPurger(ctx context.Context) {
+    ticker := time.NewTicker(s.purgeInterval)
+    defer ticker.Stop()
+    for {
+        select {
+        case <-ctx.Done():
+            return
+        case <-ticker.C:
+        }
+        n, err := s.PurgeExpired(ctx)
+        if err != nil && ctx.Err() == nil {
+            log.Error().Err(err).Msg("purge idempotency keys")
+        } else if n > 0 {
+            log.Info().Int64("keys", n).Msg("expired idempotency keys purged")
+        }
+    }
+}
@@ -0,0 +1,57 @@
+package service
+
+import (
+    "context"
+    "fmt"
+    "time"
+)
+
+type LocationInventory struct {
+    LocationID string    `json:"location_id"`
+    OnHand     int       `json:"on_hand"`
+    Pallets    []string  `json:"pallets"`
+    UpdatedAt  time.Time `json:"updated_at"`
+}
+
+type PalletInventory struct {
+    PalletID       string    `json:"pallet_id"`
+    LocationID     string    `json:"location_id"`
+    LastTransferID string    `json:"last_transfer_id"`
+    UpdatedAt      time.Time `json:"updated_at"`
+}
+
+// InventoryProjection maintains on-hand pallets per location from
+// transfer.completed events.
+type InventoryProjection struct{}
+
+func (InventoryProjection) Name() string     { return "inventory" }
+func (InventoryProjection) Topics() []string { return []string{EventTransferCompleted} }
+
+func (InventoryProjection) Apply(ctx context.Context, tx Repo, ev OutboxEvent) error {
+    var evt TransferCompleted
+    if err := decodeEvent(ev, &evt); err != nil { return err }
+    if evt.PalletID == "" || evt.To == "" {
+        return fmt.Errorf("%w: %s %s needs pallet_id and to", ErrMalformedEvent, ev.Topic, ev.ID)
+    }
+    at := evt.Ts
+    if at.IsZero() { at = ev.CreatedAt }
+    return tx.MovePallet(ctx, evt.PalletID, evt.To, evt.TransferID, at)
+}
+
+func (InventoryProjection) Reset(ctx context.Context, tx Repo) error {
+    return tx.TruncateReadModel(ctx, "inventory_locations", "inventory_pallets")
+}
+
+type InventoryService struct {
+    repo Repo
+}
+
+func NewInventoryService(r Repo) *InventoryService { return &InventoryService{repo: r} }
+
+func (s *InventoryService) GetLocation(ctx context.Context, locationID string) (*LocationInventory, error) {
+    return s.repo.GetLocationInventory(ctx, locationID)
+}
+
+func (s *InventoryService) GetPallet(ctx context.Context, palletID string) (*PalletInventory, error) {
+    return s.repo.GetPalletInventory(ctx, palletID)
+}
@@ -0,0 +1,109 @@
+package service
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "strings"
+    "time"
+
+    "github.com/rs/zerolog/log"
+)
+
+// Location is a storage slot/rack position. Capacity is the maximum number
+// of open transfers (pending, accepted, in_progress) that may target it.
+type Location struct {
+    Code      string    `json:"code"`
+    Zone      string    `json:"zone"`
+    Room      string    `json:"room"`
+    Type      string    `json:"type"`
+    Capacity  int       `json:"capacity"`
+    Active    bool      `json:"active"`
+    CreatedAt time.Time `json:"created_at"`
+    UpdatedAt time.Time `json:"updated_at"`
+}
+
+type LocationRequest struct {
+    Code     string `json:"code"`
+    Zone     string `json:"zone"`
+    Room     string `json:"room"`
+    Type     string `json:"type"`
+    Capacity int    `json:"capacity"`
+    Active   *bool  `json:"active,omitempty"`
+}
+
+type LocationService struct {
+    repo Repo
+}
+
+func NewLocationService(r Repo) *LocationService { return &LocationService{repo: r} }
+
+func (req LocationRequest) validate() error {
+    if strings.TrimSpace(req.Code) == "" {
+        return fmt.Errorf("%w: code is required", ErrInvalidRequest)
+    }
+    if req.Capacity <= 0 {
+        return fmt.Errorf("%w: capacity must be greater than zero", ErrInvalidRequest)
+    }
+    return nil
+}
+
+func (s *LocationService) Create(ctx context.Context, req LocationRequest) (*Location, error) {
+    if err := req.validate(); err != nil { return nil, err }
+    now := time.Now().UTC()
+    loc := &Location{Code:strings.TrimSpace(req.Code), Zone:req.Zone, Room:req.Room, Type:req.Type, Capacity:req.Capacity, Active:true, CreatedAt:now, UpdatedAt:now}
+    if req.Active != nil { loc.Active = *req.Active }
+    if err := s.repo.CreateLocation(ctx, loc); err != nil { return nil, err }
+    log.Info().Str("location", loc.Code).Msg("location created")
+    return loc, nil
+}
+
+func (s *LocationService) Get(ctx context.Context, code string) (*Location, error) {
+    return s.repo.GetLocation(ctx, code)
+}
+
+func (s *LocationService) List(ctx context.Context, activeOnly bool) ([]Location, error) {
+    return s.repo.ListLocations(ctx, activeOnly)
+}
+
+// Update replaces the mutable attributes of a location; the code is taken
+// from the path and cannot change.
+func (s *LocationService) Update(ctx context.Context, code string, req LocationRequest) (*Location, error) {
+    req.Code = code
+    if err := req.validate(); err != nil { return nil, err }
+    loc, err := s.repo.GetLocation(ctx, code)
+    if err != nil { return nil, err }
+    loc.Zone, loc.Room, loc.Type, loc.Capacity = req.Zone, req.Room, req.Type, req.Capacity
+    if req.Active != nil { loc.Active = *req.Active }
+    loc.UpdatedAt = time.Now().UTC()
+    if err := s.repo.UpdateLocation(ctx, loc); err != nil { return nil, err }
+    log.Info().Str("location", loc.Code).Msg("location updated")
+    return loc, nil
+}
+
+// Deactivate keeps the row for history but stops new transfers using it.
+func (s *LocationService) Deactivate(ctx context.Context, code string) error {
+    loc, err := s.repo.GetLocation(ctx, code)
+    if err != nil { return err }
+    loc.Active = false
+    loc.UpdatedAt = time.Now().UTC()
+    if err := s.repo.UpdateLocation(ctx, loc); err != nil { return err }
+    log.Info().Str("location", code).Msg("location deactivated")
+    return nil
+}
+
+// activeLocation loads code and rejects unknown or inactive locations. With
+// lock set the row stays locked until the surrounding transaction ends.
+func activeLocation(ctx context.Context, r Repo, code, field string, lock bool) (*Location, error) {
+    get := r.GetLocation
+    if lock { get = r.LockLocation }
+    loc, err := get(ctx, code)
+    if errors.Is(err, ErrNotFound) {
+        return nil, fmt.Errorf("%w: %s %q does not exist", ErrInvalidRequest, field, code)
+    }
+    if err != nil { return nil, err }
+    if !loc.Active {
+        return nil, fmt.Errorf("%w: %s %q is inactive", ErrInvalidRequest, field, code)
+    }
+    return loc, nil
+}
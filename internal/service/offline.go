@@ -0,0 +1,100 @@
+package service
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "time"
+
+    "github.com/google/uuid"
+    "github.com/rs/zerolog/log"
+)
+
+// RoomHeartbeat is the latest reading seen for a room. LastReadingAt is the
+// sensor timestamp; ReceivedAt is when the service got it.
+type RoomHeartbeat struct {
+    RoomID        string    `json:"room_id"`
+    LastReadingAt time.Time `json:"last_reading_at"`
+    LastTemp      float64   `json:"last_temp"`
+    ReceivedAt    time.Time `json:"received_at"`
+}
+
+// clearOffline closes the room's active offline alert, if any, when a
+// reading arrives.
+func clearOffline(ctx context.Context, tx Repo, rd TemperatureReading) ([]alertChange, error) {
+    open, err := tx.GetOpenAlert(ctx, rd.RoomID, ConditionOffline)
+    if errors.Is(err, ErrNotFound) { return nil, nil }
+    if err != nil { return nil, err }
+    now := time.Now().UTC()
+    open.Temp = rd.Temp
+    // The outage started on the receive clock, so it ends on it too.
+    trackDuration(open, now)
+    open.UpdatedAt = now
+    open.ClearedAt = &now
+    if err := tx.UpdateAlert(ctx, open); err != nil { return nil, err }
+    if err := clearAlert(ctx, tx, open); err != nil { return nil, err }
+    return []alertChange{{EventSensorOfflineCleared, open}}, nil
+}
+
+// CheckOffline raises an offline alert for every room whose sensor has not
+// reported within its gap. Only rooms with a profile are checked, since the
+// reporting interval lives there. It returns how many alerts were raised.
+func (s *TemperatureService) CheckOffline(ctx context.Context) (int, error) {
+    now := time.Now().UTC()
+    rooms, err := s.repo.ListOfflineCandidates(ctx, now)
+    if err != nil { return 0, err }
+    raised := 0
+    for i := range rooms {
+        a, err := s.raiseOffline(ctx, &rooms[i], now)
+        if err != nil { return raised, err }
+        if a == nil { continue }
+        raised++
+        log.Warn().Str("event",EventSensorOffline).Str("room",a.RoomID).Time("last_received_at",a.ExcursionStartedAt).Msg("sensor offline")
+    }
+    return raised, nil
+}
+
+// raiseOffline re-checks the candidate under the room's alert lock, since a
+// reading may have been ingested after ListOfflineCandidates. The gap runs
+// from when the last reading was received, not from the sensor's own
+// timestamp.
+func (s *TemperatureService) raiseOffline(ctx context.Context, room *Room, now time.Time) (*Alert, error) {
+    var a *Alert
+    err := s.repo.WithTx(ctx, func(tx Repo) error {
+        if err := tx.LockRoomAlerts(ctx, room.ID); err != nil { return err }
+        last, received, temp := room.CreatedAt, room.CreatedAt, 0.0
+        hb, err := tx.GetHeartbeat(ctx, room.ID)
+        if err != nil && !errors.Is(err, ErrNotFound) { return err }
+        if hb != nil { last, received, temp = hb.LastReadingAt, hb.ReceivedAt, hb.LastTemp }
+        gap := now.Sub(received)
+        if gap < room.OfflineAfter() { return nil }
+        if _, err := tx.GetOpenAlert(ctx, room.ID, ConditionOffline); !errors.Is(err, ErrNotFound) { return err }
+
+        msg := fmt.Sprintf("no reading received since %s (expected every %ds)", received.Format(time.RFC3339), room.ReportIntervalSeconds)
+        a = &Alert{ID: uuid.New().String(), RoomID: room.ID, Condition: ConditionOffline, Level: LevelCritical, Status: AlertOpen, Temp: temp, PeakTemp: temp, Message: msg, ExcursionStartedAt: received, DurationSeconds: gap.Seconds(), Created: now, UpdatedAt: now}
+        if err := tx.CreateAlert(ctx, a); err != nil { return err }
+        evt := SensorOffline{AlertID:a.ID, RoomID:a.RoomID, LastReadingAt:last, GapSeconds:gap.Seconds(), Ts:now}
+        return tx.InsertOutbox(ctx, AggregateTemperature, a.ID, EventSensorOffline, evt)
+    })
+    if err != nil { return nil, err }
+    return a, nil
+}
+
+// RunOfflineMonitor checks for offline sensors every offlineCheck until ctx
+// is cancelled.
+func (s *TemperatureService) RunOfflineMonitor(ctx context.Context) {
+    log.Info().Dur("interval", s.offlineCheck).Msg("sensor offline monitor started")
+    ticker := time.NewTicker(s.offlineCheck)
+    defer ticker.Stop()
+    for {
+        select {
+        case <-ctx.Done():
+            log.Info().Msg("sensor offline monitor stopped")
+            return
+        case <-ticker.C:
+        }
+        if _, err := s.CheckOffline(ctx); err != nil && ctx.Err() == nil {
+            log.Error().Err(err).Msg("sensor offline monitor")
+        }
+    }
+}
@@ -0,0 +1,43 @@
+package service_test
+
+import (
+    "context"
+    "errors"
+    "testing"
+    "time"
+
+    "transfer-service/internal/service"
+)
+
+func TestOfflineAlertRaisedAndCleared(t *testing.T) {
+    r := testRepo(t)
+    ctx := context.Background()
+    room, err := service.NewRoomService(r).Create(ctx, service.RoomRequest{ID: uniqueID("ROOM"), CriticalMin: -10, WarningMin: -5, WarningMax: 8, CriticalMax: 12, ReportIntervalSeconds: 1, OfflineAfterSeconds: 1})
+    if err != nil { t.Fatalf("create room: %v", err) }
+    temps := service.NewTemperatureService(r)
+    openOffline := func() *service.Alert {
+        t.Helper()
+        a, err := r.GetOpenAlert(ctx, room.ID, service.ConditionOffline)
+        if errors.Is(err, service.ErrNotFound) { return nil }
+        if err != nil { t.Fatalf("get offline alert: %v", err) }
+        return a
+    }
+
+    // A buffered reading with an old sensor timestamp still counts as a
+    // heartbeat: the gap runs from when it was received.
+    if err := temps.Ingest(ctx, []service.TemperatureReading{{RoomID: room.ID, Temp: 2, Ts: time.Now().UTC().Add(-time.Hour)}}); err != nil { t.Fatalf("ingest: %v", err) }
+    if _, err := temps.CheckOffline(ctx); err != nil { t.Fatalf("check offline: %v", err) }
+    if a := openOffline(); a != nil { t.Fatalf("offline alert raised right after a reading was received: %+v", a) }
+
+    time.Sleep(1500 * time.Millisecond)
+    if _, err := temps.CheckOffline(ctx); err != nil { t.Fatalf("check offline: %v", err) }
+    a := openOffline()
+    if a == nil { t.Fatal("no offline alert after the room stopped reporting") }
+    if a.Level != service.LevelCritical || a.Status != service.AlertOpen { t.Fatalf("offline alert = %s/%s, want critical/open", a.Level, a.Status) }
+
+    if err := temps.Ingest(ctx, []service.TemperatureReading{{RoomID: room.ID, Temp: 3}}); err != nil { t.Fatalf("ingest: %v", err) }
+    if a := openOffline(); a != nil { t.Fatalf("offline alert still active after a reading: %+v", a) }
+    cleared, err := r.GetAlert(ctx, a.ID)
+    if err != nil { t.Fatalf("get alert: %v", err) }
+    if cleared.ClearedAt == nil || cleared.DurationSeconds < 1 { t.Fatalf("cleared alert = %+v, want cleared_at set and duration >= 1s", cleared) }
+}
@@ -0,0 +1,104 @@
+package service
+
+import (
+    "context"
+    "database/sql/driver"
+    "encoding/json"
+    "fmt"
+    "strings"
+    "time"
+
+    "github.com/rs/zerolog/log"
+)
+
+// Pallet statuses.
+const (
+    PalletStored    = "stored"
+    PalletInTransit = "in_transit"
+)
+
+// Date is a calendar day without time of day or zone, as stored in DATE
+// columns. It is encoded as "2006-01-02" in JSON.
+type Date struct {
+    time.Time
+}
+
+const dateLayout = "2006-01-02"
+
+func (d Date) String() string { return d.Format(dateLayout) }
+
+func (d Date) MarshalJSON() ([]byte, error) { return json.Marshal(d.String()) }
+
+func (d *Date) UnmarshalJSON(b []byte) error {
+    var s string
+    if err := json.Unmarshal(b, &s); err != nil { return err }
+    t, err := time.Parse(dateLayout, s)
+    if err != nil { return fmt.Errorf("date %q must be YYYY-MM-DD", s) }
+    d.Time = t
+    return nil
+}
+
+func (d Date) Value() (driver.Value, error) { return d.String(), nil }
+
+func (d *Date) Scan(src interface{}) error {
+    t, ok := src.(time.Time)
+    if !ok { return fmt.Errorf("cannot scan %T into Date", src) }
+    d.Time = time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+    return nil
+}
+
+// Pallet is identified by its SSCC, which is also the pallet_id used on
+// transfers. CurrentLocation is only changed by completed transfers.
+type Pallet struct {
+    SSCC            string     `json:"sscc"`
+    SKU             string     `json:"sku"`
+    Lot             string     `json:"lot"`
+    Expiry          *Date      `json:"expiry,omitempty" swaggertype:"string" format:"date" example:"2027-03-31"`
+    Quantity        int        `json:"quantity"`
+    CurrentLocation string     `json:"current_location"`
+    Status          string     `json:"status"`
+    CreatedAt       time.Time  `json:"created_at"`
+    UpdatedAt       time.Time  `json:"updated_at"`
+}
+
+type RegisterPalletRequest struct {
+    SSCC     string     `json:"sscc"`
+    SKU      string     `json:"sku"`
+    Lot      string     `json:"lot"`
+    Expiry   *Date      `json:"expiry,omitempty" swaggertype:"string" format:"date" example:"2027-03-31"`
+    Quantity int        `json:"quantity"`
+    Location string     `json:"location"`
+}
+
+type PalletService struct {
+    repo Repo
+}
+
+func NewPalletService(r Repo) *PalletService { return &PalletService{repo: r} }
+
+func (s *PalletService) Register(ctx context.Context, req RegisterPalletRequest) (*Pallet, error) {
+    req.SSCC = strings.TrimSpace(req.SSCC)
+    if req.SSCC == "" || req.SKU == "" || req.Location == "" {
+        return nil, fmt.Errorf("%w: sscc, sku and location are required", ErrInvalidRequest)
+    }
+    if req.Quantity <= 0 {
+        return nil, fmt.Errorf("%w: quantity must be positive", ErrInvalidRequest)
+    }
+    now := time.Now().UTC()
+    p := &Pallet{SSCC:req.SSCC, SKU:req.SKU, Lot:req.Lot, Expiry:req.Expiry, Quantity:req.Quantity, CurrentLocation:req.Location, Status:PalletStored, CreatedAt:now, UpdatedAt:now}
+    err := s.repo.WithTx(ctx, func(tx Repo) error {
+        if _, err := activeLocation(ctx, tx, req.Location, "location", false); err != nil { return err }
+        return tx.CreatePallet(ctx, p)
+    })
+    if err != nil { return nil, err }
+    log.Info().Str("sscc", p.SSCC).Str("location", p.CurrentLocation).Msg("pallet registered")
+    return p, nil
+}
+
+func (s *PalletService) Get(ctx context.Context, sscc string) (*Pallet, error) {
+    return s.repo.GetPallet(ctx, sscc)
+}
+
+func (s *PalletService) List(ctx context.Context, location string) ([]Pallet, error) {
+    return s.repo.ListPallets(ctx, location)
+}
@@ -0,0 +1,21 @@
+package service_test
+
+import (
+    "encoding/json"
+    "testing"
+
+    "transfer-service/internal/service"
+)
+
+func TestRegisterPalletRequestExpiryIsDateOnly(t *testing.T) {
+    var req service.RegisterPalletRequest
+    if err := json.Unmarshal([]byte(`{"sscc":"S1","expiry":"2027-03-31"}`), &req); err != nil { t.Fatalf("unmarshal: %v", err) }
+    if req.Expiry == nil || req.Expiry.String() != "2027-03-31" { t.Fatalf("expiry = %v, want 2027-03-31", req.Expiry) }
+    b, err := json.Marshal(service.Pallet{Expiry: req.Expiry})
+    if err != nil { t.Fatalf("marshal: %v", err) }
+    var out map[string]interface{}
+    if err := json.Unmarshal(b, &out); err != nil { t.Fatalf("unmarshal: %v", err) }
+    if out["expiry"] != "2027-03-31" { t.Fatalf("expiry encoded as %v", out["expiry"]) }
+
+    if err := json.Unmarshal([]byte(`{"expiry":"2027-03-31T00:00:00Z"}`), &req); err == nil { t.Fatal("timestamp expiry accepted, want YYYY-MM-DD only") }
+}
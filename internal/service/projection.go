@@ -0,0 +1,175 @@
+package service
+
+import (
+    "context"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "os"
+    "time"
+
+    "github.com/rs/zerolog/log"
+)
+
+// ErrOutboxPurged is returned by Rebuild when retention has already deleted
+// outbox events, so a replay from the outbox alone would be incomplete.
+var ErrOutboxPurged = errors.New("outbox events have been purged")
+
+// ErrMalformedEvent marks an event a projection can never apply, such as a
+// payload that does not decode or lacks the fields the projection keys on.
+// Projections wrap it so the runner skips the event instead of retrying it.
+var ErrMalformedEvent = errors.New("malformed event")
+
+// decodeEvent unmarshals the event payload into v, reporting a payload that
+// does not decode as ErrMalformedEvent.
+func decodeEvent(ev OutboxEvent, v any) error {
+    if err := json.Unmarshal([]byte(ev.Payload), v); err != nil {
+        return fmt.Errorf("%w: %s %s: %v", ErrMalformedEvent, ev.Topic, ev.ID, err)
+    }
+    return nil
+}
+
+// OutboxPosition is a point in the outbox event log. Events are ordered by
+// the id of the transaction that wrote them and then by seq, because seq
+// alone is handed out before commit and does not follow commit order.
+type OutboxPosition struct {
+    Xid uint64 `json:"xid"`
+    Seq int64  `json:"seq"`
+}
+
+func (ev OutboxEvent) Position() OutboxPosition { return OutboxPosition{Xid: ev.Xid, Seq: ev.Seq} }
+
+// Projection is a read model built from outbox events. Apply is called in
+// log order inside the same transaction that advances the checkpoint; Reset
+// must wipe every table the projection owns so it can be replayed from the
+// first event.
+type Projection interface {
+    Name() string
+    Topics() []string
+    Apply(ctx context.Context, tx Repo, ev OutboxEvent) error
+    Reset(ctx context.Context, tx Repo) error
+}
+
+// ProjectionRunner keeps projections caught up with the outbox and rebuilds
+// them on demand.
+type ProjectionRunner struct {
+    repo        Repo
+    projections []Projection
+    interval    time.Duration
+    batchSize   int
+}
+
+func NewProjectionRunner(r Repo, projections ...Projection) *ProjectionRunner {
+    interval := 2 * time.Second
+    if v := os.Getenv("PROJECTION_POLL_INTERVAL"); v != "" {
+        if d, err := time.ParseDuration(v); err == nil && d > 0 { interval = d }
+    }
+    return &ProjectionRunner{repo: r, projections: projections, interval: interval, batchSize: 500}
+}
+
+func (p *ProjectionRunner) Projections() []Projection { return p.projections }
+
+func (p *ProjectionRunner) Names() []string {
+    names := make([]string, len(p.projections))
+    for i, pr := range p.projections { names[i] = pr.Name() }
+    return names
+}
+
+func (p *ProjectionRunner) Get(name string) (Projection, error) {
+    for _, pr := range p.projections {
+        if pr.Name() == name { return pr, nil }
+    }
+    return nil, fmt.Errorf("%w: unknown projection %q", ErrNotFound, name)
+}
+
+// Run keeps every projection up to date until ctx is cancelled.
+func (p *ProjectionRunner) Run(ctx context.Context) {
+    log.Info().Dur("interval", p.interval).Int("projections", len(p.projections)).Msg("projection runner started")
+    ticker := time.NewTicker(p.interval)
+    defer ticker.Stop()
+    for {
+        for _, pr := range p.projections {
+            if _, err := p.CatchUp(ctx, pr); err != nil && ctx.Err() == nil {
+                log.Error().Err(err).Str("projection", pr.Name()).Msg("projection")
+            }
+        }
+        select {
+        case <-ctx.Done():
+            log.Info().Msg("projection runner stopped")
+            return
+        case <-ticker.C:
+        }
+    }
+}
+
+// CatchUp applies batches until the projection reaches the end of the outbox.
+func (p *ProjectionRunner) CatchUp(ctx context.Context, pr Projection) (int, error) {
+    total := 0
+    for ctx.Err() == nil {
+        n, err := p.ProjectOnce(ctx, pr)
+        total += n
+        if err != nil { return total, err }
+        if n < p.batchSize { break }
+    }
+    return total, ctx.Err()
+}
+
+// ProjectOnce applies the next batch of events after the checkpoint. An event
+// the projection rejects as ErrMalformedEvent is rolled back on its own,
+// logged and skipped, so one bad payload does not stall the projection
+// behind it. Any other error aborts the batch without moving the checkpoint,
+// and the events are retried on the next run.
+func (p *ProjectionRunner) ProjectOnce(ctx context.Context, pr Projection) (int, error) {
+    var n int
+    err := p.repo.WithTx(ctx, func(tx Repo) error {
+        pos, err := tx.GetCheckpoint(ctx, pr.Name())
+        if err != nil { return err }
+        events, err := tx.ListOutboxAfter(ctx, pos, pr.Topics(), p.batchSize)
+        if err != nil || len(events) == 0 { return err }
+        for _, ev := range events {
+            err := tx.WithTx(ctx, func(tx Repo) error { return pr.Apply(ctx, tx, ev) })
+            if err == nil { continue }
+            if ctx.Err() != nil { return ctx.Err() }
+            if !errors.Is(err, ErrMalformedEvent) { return fmt.Errorf("apply %s: %w", ev.ID, err) }
+            log.Error().Err(err).Str("projection", pr.Name()).Str("event_id", ev.ID).Int64("seq", ev.Seq).
+                Str("topic", ev.Topic).Msg("projection skipped event")
+        }
+        n = len(events)
+        return tx.SaveCheckpoint(ctx, pr.Name(), events[len(events)-1].Position())
+    })
+    return n, err
+}
+
+// Rebuild drops the projection's data, rewinds its checkpoint and replays
+// the full event history. Once retention has purged outbox events the
+// history is incomplete and Rebuild refuses unless force is set, in which
+// case only the events still in the outbox are replayed. progress, if set,
+// is called after every batch.
+func (p *ProjectionRunner) Rebuild(ctx context.Context, pr Projection, force bool, progress func(done, total int)) error {
+    purged, err := p.repo.PurgedRows(ctx, RetentionOutbox)
+    if err != nil { return err }
+    if purged > 0 {
+        if !force { return fmt.Errorf("%w: %d events exist only in the archive, replay would be incomplete", ErrOutboxPurged, purged) }
+        log.Warn().Str("projection", pr.Name()).Int64("purged", purged).Msg("rebuilding without purged outbox events")
+    }
+    total, err := p.repo.CountOutboxAfter(ctx, 0, pr.Topics())
+    if err != nil { return err }
+    err = p.repo.WithTx(ctx, func(tx Repo) error {
+        if _, err := tx.GetCheckpoint(ctx, pr.Name()); err != nil { return err }
+        if err := pr.Reset(ctx, tx); err != nil { return err }
+        return tx.SaveCheckpoint(ctx, pr.Name(), OutboxPosition{})
+    })
+    if err != nil { return err }
+    log.Info().Str("projection", pr.Name()).Int("events", total).Msg("projection reset, replaying")
+    done := 0
+    for ctx.Err() == nil {
+        n, err := p.ProjectOnce(ctx, pr)
+        if err != nil { return err }
+        done += n
+        if progress != nil && n > 0 { progress(done, total) }
+        if n < p.batchSize { break }
+    }
+    if err := ctx.Err(); err != nil { return err }
+    log.Info().Str("projection", pr.Name()).Int("events", done).Msg("projection rebuilt")
+    return nil
+}
@@ -0,0 +1,110 @@
+package service_test
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "testing"
+
+    "transfer-service/internal/service"
+)
+
+// logRepo serves a fixed outbox log and one checkpoint. Other Repo methods
+// are not used by the runner.
+type logRepo struct {
+    service.Repo
+    events     []service.OutboxEvent
+    checkpoint service.OutboxPosition
+}
+
+func (r *logRepo) WithTx(ctx context.Context, fn func(service.Repo) error) error { return fn(r) }
+
+func (r *logRepo) GetCheckpoint(ctx context.Context, name string) (service.OutboxPosition, error) {
+    return r.checkpoint, nil
+}
+
+func (r *logRepo) SaveCheckpoint(ctx context.Context, name string, pos service.OutboxPosition) error {
+    r.checkpoint = pos
+    return nil
+}
+
+func (r *logRepo) ListOutboxAfter(ctx context.Context, after service.OutboxPosition, topics []string, limit int) ([]service.OutboxEvent, error) {
+    var out []service.OutboxEvent
+    for _, ev := range r.events {
+        if ev.Seq > after.Seq && len(out) < limit { out = append(out, ev) }
+    }
+    return out, nil
+}
+
+// stubProjection fails the events listed in errs and records the rest.
+type stubProjection struct {
+    errs    map[string]error
+    applied []string
+}
+
+func (p *stubProjection) Name() string     { return "stub" }
+func (p *stubProjection) Topics() []string { return nil }
+func (p *stubProjection) Reset(ctx context.Context, tx service.Repo) error { return nil }
+
+func (p *stubProjection) Apply(ctx context.Context, tx service.Repo, ev service.OutboxEvent) error {
+    if err := p.errs[ev.ID]; err != nil { return err }
+    p.applied = append(p.applied, ev.ID)
+    return nil
+}
+
+func threeEvents() []service.OutboxEvent {
+    return []service.OutboxEvent{{ID: "a", Xid: 1, Seq: 1}, {ID: "b", Xid: 1, Seq: 2}, {ID: "c", Xid: 2, Seq: 3}}
+}
+
+func TestProjectOnceSkipsMalformedEvents(t *testing.T) {
+    repo := &logRepo{events: threeEvents()}
+    pr := &stubProjection{errs: map[string]error{"b": fmt.Errorf("%w: bad payload", service.ErrMalformedEvent)}}
+    n, err := service.NewProjectionRunner(repo).ProjectOnce(context.Background(), pr)
+    if err != nil { t.Fatal(err) }
+    if n != 3 { t.Fatalf("n = %d, want 3", n) }
+    if fmt.Sprint(pr.applied) != "[a c]" { t.Fatalf("applied %v, want [a c]", pr.applied) }
+    if want := (service.OutboxPosition{Xid: 2, Seq: 3}); repo.checkpoint != want {
+        t.Fatalf("checkpoint = %+v, want %+v", repo.checkpoint, want)
+    }
+}
+
+func TestProjectOnceKeepsCheckpointOnTransientError(t *testing.T) {
+    repo := &logRepo{events: threeEvents()}
+    transient := errors.New("connection reset")
+    pr := &stubProjection{errs: map[string]error{"b": transient}}
+    runner := service.NewProjectionRunner(repo)
+    if _, err := runner.ProjectOnce(context.Background(), pr); !errors.Is(err, transient) {
+        t.Fatalf("err = %v, want %v", err, transient)
+    }
+    if repo.checkpoint != (service.OutboxPosition{}) {
+        t.Fatalf("checkpoint advanced to %+v after a transient error", repo.checkpoint)
+    }
+
+    // Once the failure clears, the same batch is applied from the start.
+    delete(pr.errs, "b")
+    pr.applied = nil
+    if _, err := runner.ProjectOnce(context.Background(), pr); err != nil { t.Fatal(err) }
+    if fmt.Sprint(pr.applied) != "[a b c]" { t.Fatalf("applied %v, want [a b c]", pr.applied) }
+}
+
+func TestProjectionsRejectUndecodablePayload(t *testing.T) {
+    ev := service.OutboxEvent{ID: "x", Payload: "{not json"}
+    for _, pr := range []service.Projection{service.InventoryProjection{}, service.RoomAlertsProjection{}, service.OperatorStatsProjection{}} {
+        if err := pr.Apply(context.Background(), nil, ev); !errors.Is(err, service.ErrMalformedEvent) {
+            t.Errorf("%s: err = %v, want ErrMalformedEvent", pr.Name(), err)
+        }
+    }
+}
+
+func TestInventoryProjectionRejectsMissingIDs(t *testing.T) {
+    for _, payload := range []string{
+        `{"transfer_id":"t1","to":"B-01"}`,
+        `{"transfer_id":"t1","pallet_id":"P-1"}`,
+        `{"transfer_id":"t1","pallet_id":"","to":""}`,
+    } {
+        ev := service.OutboxEvent{ID: "x", Topic: service.EventTransferCompleted, Payload: payload}
+        if err := (service.InventoryProjection{}).Apply(context.Background(), nil, ev); !errors.Is(err, service.ErrMalformedEvent) {
+            t.Errorf("%s: err = %v, want ErrMalformedEvent", payload, err)
+        }
+    }
+}
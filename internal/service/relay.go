@@ -0,0 +1,167 @@
+package service
+
+import (
+    "context"
+    "math/rand"
+    "os"
+    "strconv"
+    "time"
+
+    "github.com/rs/zerolog/log"
+)
+
+type OutboxEvent struct {
+    ID            string     `json:"id"`
+    Seq           int64      `json:"seq"`
+    Xid           uint64     `json:"xid"`
+    AggregateType string     `json:"aggregate_type"`
+    AggregateID   string     `json:"aggregate_id"`
+    Topic         string     `json:"topic"`
+    Payload       string     `json:"payload"`
+    Attempts      int        `json:"attempts"`
+    LastError     *string    `json:"last_error,omitempty"`
+    NextAttemptAt *time.Time `json:"next_attempt_at,omitempty"`
+    DeadLetter    bool       `json:"dead_letter"`
+    CreatedAt     time.Time  `json:"created_at"`
+}
+
+// Publisher delivers a batch of outbox events to a downstream sink. The batch
+// is only marked published when Publish returns nil.
+type Publisher interface {
+    Publish(ctx context.Context, events []OutboxEvent) error
+}
+
+// OutboxRelay moves unpublished outbox rows out of the database. Batches are
+// leased for claimLease with FOR UPDATE SKIP LOCKED, so several replicas can
+// relay at once without publishing the same event twice; a batch abandoned
+// by a crashed relay is picked up again once its lease runs out. Failed
+// events are retried with exponential backoff and dead-lettered after
+// maxAttempts.
+type OutboxRelay struct {
+    repo        Repo
+    publisher   Publisher
+    interval    time.Duration
+    batchSize   int
+    maxAttempts int
+    backoffBase time.Duration
+    backoffMax  time.Duration
+    claimLease  time.Duration
+}
+
+func NewOutboxRelay(r Repo, p Publisher) *OutboxRelay {
+    interval := time.Second
+    if v := os.Getenv("OUTBOX_POLL_INTERVAL"); v != "" {
+        if d, err := time.ParseDuration(v); err == nil && d > 0 { interval = d }
+    }
+    batch := 100
+    if v := os.Getenv("OUTBOX_BATCH_SIZE"); v != "" {
+        if n, err := strconv.Atoi(v); err == nil && n > 0 { batch = n }
+    }
+    maxAttempts := 10
+    if v := os.Getenv("OUTBOX_MAX_ATTEMPTS"); v != "" {
+        if n, err := strconv.Atoi(v); err == nil && n > 0 { maxAttempts = n }
+    }
+    base := time.Second
+    if v := os.Getenv("OUTBOX_BACKOFF_BASE"); v != "" {
+        if d, err := time.ParseDuration(v); err == nil && d > 0 { base = d }
+    }
+    max := 10 * time.Minute
+    if v := os.Getenv("OUTBOX_BACKOFF_MAX"); v != "" {
+        if d, err := time.ParseDuration(v); err == nil && d > 0 { max = d }
+    }
+    lease := 5 * time.Minute
+    if v := os.Getenv("OUTBOX_CLAIM_LEASE"); v != "" {
+        if d, err := time.ParseDuration(v); err == nil && d > 0 { lease = d }
+    }
+    return &OutboxRelay{repo: r, publisher: p, interval: interval, batchSize: batch, maxAttempts: maxAttempts, backoffBase: base, backoffMax: max, claimLease: lease}
+}
+
+// Run polls the outbox until ctx is cancelled. Each tick drains every
+// pending batch before sleeping again.
+func (o *OutboxRelay) Run(ctx context.Context) {
+    log.Info().Dur("interval", o.interval).Int("batch_size", o.batchSize).Msg("outbox relay started")
+    ticker := time.NewTicker(o.interval)
+    defer ticker.Stop()
+    for {
+        if _, err := o.Drain(ctx); err != nil && ctx.Err() == nil {
+            log.Error().Err(err).Msg("outbox relay")
+        }
+        select {
+        case <-ctx.Done():
+            log.Info().Msg("outbox relay stopped")
+            return
+        case <-ticker.C:
+        }
+    }
+}
+
+// Drain publishes batches until no event is due and returns how many events
+// were published.
+func (o *OutboxRelay) Drain(ctx context.Context) (int, error) {
+    total := 0
+    for ctx.Err() == nil {
+        claimed, published, err := o.RunOnce(ctx)
+        total += published
+        if err != nil { return total, err }
+        if claimed < o.batchSize { break }
+    }
+    return total, nil
+}
+
+// RunOnce leases a single batch of due events and publishes them one by one
+// outside any transaction, settling each event as soon as its publish
+// returns. A slow sink therefore holds no row locks and keeps no transaction
+// (and so no projection) waiting, and a failing event is rescheduled without
+// holding back the rest. Events left unsettled when ctx is cancelled are
+// retried once their lease runs out.
+func (o *OutboxRelay) RunOnce(ctx context.Context) (claimed, published int, err error) {
+    now := time.Now().UTC()
+    events, err := o.repo.ClaimOutboxBatch(ctx, o.batchSize, now, now.Add(o.claimLease))
+    if err != nil { return 0, 0, err }
+    claimed = len(events)
+    for _, ev := range events {
+        if err := ctx.Err(); err != nil { return claimed, published, err }
+        perr := o.publisher.Publish(ctx, []OutboxEvent{ev})
+        if perr == nil {
+            if err := o.repo.MarkOutboxPublished(ctx, []string{ev.ID}); err != nil { return claimed, published, err }
+            published++
+            continue
+        }
+        attempts := ev.Attempts + 1
+        dead := attempts >= o.maxAttempts
+        next := time.Now().UTC().Add(o.backoff(attempts))
+        if err := o.repo.MarkOutboxFailed(ctx, ev.ID, perr.Error(), next, dead); err != nil { return claimed, published, err }
+        if dead {
+            log.Error().Err(perr).Str("event_id", ev.ID).Str("topic", ev.Topic).Int("attempts", attempts).Msg("outbox event dead-lettered")
+        } else {
+            log.Warn().Err(perr).Str("event_id", ev.ID).Str("topic", ev.Topic).Int("attempts", attempts).Time("next_attempt_at", next).Msg("outbox publish failed")
+        }
+    }
+    return claimed, published, nil
+}
+
+// backoff returns base*2^(attempts-1) capped at backoffMax, with the upper
+// half randomised so replicas retrying together spread out.
+func (o *OutboxRelay) backoff(attempts int) time.Duration {
+    d := o.backoffBase
+    for i := 1; i < attempts && d < o.backoffMax; i++ {
+        d *= 2
+    }
+    if d > o.backoffMax { d = o.backoffMax }
+    half := d / 2
+    if half <= 0 { return d }
+    return half + time.Duration(rand.Int63n(int64(half)+1))
+}
+
+func (o *OutboxRelay) ListDeadLetters(ctx context.Context, limit int) ([]OutboxEvent, error) {
+    if limit <= 0 || limit > 500 { limit = 100 }
+    return o.repo.ListDeadLetters(ctx, limit)
+}
+
+// Requeue puts a dead-lettered event back in the queue with a fresh attempt
+// budget.
+func (o *OutboxRelay) Requeue(ctx context.Context, id string) error {
+    if err := o.repo.RequeueDeadLetter(ctx, id); err != nil { return err }
+    log.Info().Str("event_id", id).Msg("outbox event requeued")
+    return nil
+}
@@ -0,0 +1,54 @@
+package service
+
+import (
+    "testing"
+    "time"
+)
+
+func TestRelayBackoff(t *testing.T) {
+    o := &OutboxRelay{backoffBase: time.Second, backoffMax: time.Minute}
+    ceiling := func(attempts int) time.Duration {
+        d := o.backoffBase << (attempts - 1)
+        if attempts > 7 || d > o.backoffMax { d = o.backoffMax }
+        return d
+    }
+
+    // Every delay is jittered into the upper half of its ceiling.
+    for attempts := 1; attempts <= 12; attempts++ {
+        c := ceiling(attempts)
+        for i := 0; i < 200; i++ {
+            d := o.backoff(attempts)
+            if d < c/2 || d > c {
+                t.Fatalf("backoff(%d) = %s, want within [%s, %s]", attempts, d, c/2, c)
+            }
+        }
+    }
+
+    // Until the cap, the ceiling doubles, so the shortest delay of the next
+    // attempt is never below the longest delay of this one.
+    for attempts := 1; ceiling(attempts+1) < o.backoffMax; attempts++ {
+        var longest time.Duration
+        shortest := time.Duration(1<<63 - 1)
+        for i := 0; i < 200; i++ {
+            if d := o.backoff(attempts); d > longest { longest = d }
+            if d := o.backoff(attempts + 1); d < shortest { shortest = d }
+        }
+        if shortest < longest {
+            t.Fatalf("backoff(%d) min %s < backoff(%d) max %s", attempts+1, shortest, attempts, longest)
+        }
+    }
+
+    // Huge attempt counts stay capped instead of overflowing.
+    for _, attempts := range []int{50, 1000, 1 << 30} {
+        if d := o.backoff(attempts); d < o.backoffMax/2 || d > o.backoffMax {
+            t.Fatalf("backoff(%d) = %s, want within [%s, %s]", attempts, d, o.backoffMax/2, o.backoffMax)
+        }
+    }
+}
+
+func TestRelayBackoffWithoutJitterRoom(t *testing.T) {
+    o := &OutboxRelay{backoffBase: time.Nanosecond, backoffMax: time.Nanosecond}
+    if d := o.backoff(5); d != time.Nanosecond {
+        t.Fatalf("backoff = %s, want 1ns", d)
+    }
+}
@@ -0,0 +1,197 @@
+package service
+
+import (
+    "compress/gzip"
+    "context"
+    "fmt"
+    "os"
+    "path/filepath"
+    "strconv"
+    "strings"
+    "time"
+
+    "github.com/rs/zerolog/log"
+)
+
+// Tables with a retention policy. Published outbox rows are only purged once
+// every registered projection has consumed them.
+const (
+    RetentionReadings = "temperature_readings"
+    RetentionOutbox   = "outbox"
+)
+
+// maxRetentionDays keeps a "<n>d" retention within time.Duration.
+const maxRetentionDays = 36500
+
+// RetentionPolicy keeps rows of Table in the live database for Keep; zero
+// disables purging for the table. Consumers names the projections whose
+// checkpoints must be past an outbox row before it can be purged.
+type RetentionPolicy struct {
+    Table     string
+    Keep      time.Duration
+    Consumers []string
+}
+
+// RetentionPurger moves expired rows to gzip NDJSON files under
+// <dir>/<table>/day=YYYY-MM-DD/part-NNNN.ndjson.gz and deletes them. Rows
+// are handled one UTC day at a time in batches of batchSize, each batch in
+// its own transaction and part file. A batch is only committed after its
+// file has been written and synced, so a crash can at worst leave a row in
+// two parts, never lose it.
+type RetentionPurger struct {
+    repo      Repo
+    dir       string
+    interval  time.Duration
+    batchSize int
+    policies  []RetentionPolicy
+}
+
+// NewRetentionPurger reads the policies from the environment. consumers are
+// the registered projection names; checkpoints left behind by projections
+// that no longer exist do not hold back the outbox purge.
+func NewRetentionPurger(r Repo, consumers ...string) *RetentionPurger {
+    dir := os.Getenv("ARCHIVE_DIR")
+    if dir == "" { dir = "archive" }
+    interval := time.Hour
+    if v := os.Getenv("RETENTION_INTERVAL"); v != "" {
+        if d, err := time.ParseDuration(v); err == nil && d > 0 { interval = d }
+    }
+    batch := 10000
+    if v := os.Getenv("RETENTION_BATCH_SIZE"); v != "" {
+        if n, err := strconv.Atoi(v); err == nil && n > 0 { batch = n }
+    }
+    var policies []RetentionPolicy
+    for _, t := range []struct{ table, env string }{
+        {RetentionReadings, "RETENTION_TEMPERATURE_READINGS"},
+        {RetentionOutbox, "RETENTION_OUTBOX"},
+    } {
+        keep, err := parseRetention(os.Getenv(t.env))
+        if err != nil {
+            log.Warn().Err(err).Str("env", t.env).Msg("invalid retention, purging disabled")
+            continue
+        }
+        if keep == 0 { continue }
+        pol := RetentionPolicy{Table: t.table, Keep: keep}
+        if t.table == RetentionOutbox { pol.Consumers = consumers }
+        policies = append(policies, pol)
+    }
+    return &RetentionPurger{repo: r, dir: dir, interval: interval, batchSize: batch, policies: policies}
+}
+
+// parseRetention accepts Go durations plus whole days, e.g. "730d".
+func parseRetention(v string) (time.Duration, error) {
+    if v == "" || v == "0" { return 0, nil }
+    if strings.HasSuffix(v, "d") {
+        n, err := strconv.Atoi(strings.TrimSuffix(v, "d"))
+        if err != nil || n < 0 || n > maxRetentionDays { return 0, fmt.Errorf("invalid retention %q", v) }
+        return time.Duration(n) * 24 * time.Hour, nil
+    }
+    d, err := time.ParseDuration(v)
+    if err != nil || d < 0 { return 0, fmt.Errorf("invalid retention %q", v) }
+    return d, nil
+}
+
+func (p *RetentionPurger) Policies() []RetentionPolicy { return p.policies }
+
+// Run purges every interval until ctx is cancelled.
+func (p *RetentionPurger) Run(ctx context.Context) {
+    if len(p.policies) == 0 {
+        log.Info().Msg("retention purger disabled")
+        return
+    }
+    log.Info().Dur("interval", p.interval).Str("dir", p.dir).Msg("retention purger started")
+    ticker := time.NewTicker(p.interval)
+    defer ticker.Stop()
+    for {
+        if _, err := p.PurgeOnce(ctx); err != nil && ctx.Err() == nil {
+            log.Error().Err(err).Msg("retention purger")
+        }
+        select {
+        case <-ctx.Done():
+            log.Info().Msg("retention purger stopped")
+            return
+        case <-ticker.C:
+        }
+    }
+}
+
+// PurgeOnce archives and deletes every whole day older than each policy's
+// retention and returns how many rows were purged.
+func (p *RetentionPurger) PurgeOnce(ctx context.Context) (int, error) {
+    total := 0
+    now := time.Now().UTC()
+    for _, pol := range p.policies {
+        cutoff := alignDown(now.Add(-pol.Keep), 24*time.Hour)
+        days, err := p.repo.ExpiredDays(ctx, pol, cutoff)
+        if err != nil { return total, err }
+        for _, day := range days {
+            if ctx.Err() != nil { return total, ctx.Err() }
+            n, err := p.purgeDay(ctx, pol, day)
+            total += n
+            if err != nil { return total, fmt.Errorf("%s %s: %w", pol.Table, day.Format("2006-01-02"), err) }
+        }
+    }
+    return total, nil
+}
+
+// purgeDay archives and deletes the expired rows of one day batch by batch,
+// so no transaction holds more than batchSize rows.
+func (p *RetentionPurger) purgeDay(ctx context.Context, pol RetentionPolicy, day time.Time) (int, error) {
+    total := 0
+    for {
+        if ctx.Err() != nil { return total, ctx.Err() }
+        n, err := p.purgeBatch(ctx, pol, day)
+        total += n
+        if err != nil || n < p.batchSize { return total, err }
+    }
+}
+
+// purgeBatch deletes one batch and streams it into a new part file, which is
+// synced and renamed into place before the deletion commits.
+func (p *RetentionPurger) purgeBatch(ctx context.Context, pol RetentionPolicy, day time.Time) (int, error) {
+    table := pol.Table
+    var path string
+    var n int
+    err := p.repo.WithTx(ctx, func(tx Repo) error {
+        var err error
+        path, err = p.nextPart(table, day)
+        if err != nil { return err }
+        tmp := path + ".tmp"
+        f, err := os.Create(tmp)
+        if err != nil { return err }
+        defer os.Remove(tmp)
+        defer f.Close()
+
+        zw := gzip.NewWriter(f)
+        n, err = tx.PurgeExpiredBatch(ctx, pol, day, p.batchSize, func(id string, row []byte) error {
+            if _, err := zw.Write(row); err != nil { return err }
+            _, err := zw.Write([]byte("\n"))
+            return err
+        })
+        if err != nil || n == 0 { return err }
+        if err := zw.Close(); err != nil { return err }
+        if err := f.Sync(); err != nil { return err }
+        if err := f.Close(); err != nil { return err }
+        return os.Rename(tmp, path)
+    })
+    if err != nil { return 0, err }
+    if n > 0 {
+        log.Info().Str("table", table).Str("day", day.Format("2006-01-02")).Int("rows", n).Str("archive", path).Msg("rows archived and purged")
+    }
+    return n, nil
+}
+
+// nextPart returns the first unused part file of the day, so late rows for
+// an already archived day never overwrite the earlier archive.
+func (p *RetentionPurger) nextPart(table string, day time.Time) (string, error) {
+    dir := filepath.Join(p.dir, table, "day="+day.Format("2006-01-02"))
+    if err := os.MkdirAll(dir, 0o755); err != nil { return "", err }
+    for i := 0; ; i++ {
+        path := filepath.Join(dir, fmt.Sprintf("part-%04d.ndjson.gz", i))
+        if _, err := os.Stat(path); os.IsNotExist(err) {
+            return path, nil
+        } else if err != nil {
+            return "", err
+        }
+    }
+}
@@ -0,0 +1,32 @@
+package service
+
+import (
+    "testing"
+    "time"
+)
+
+func TestParseRetention(t *testing.T) {
+    valid := map[string]time.Duration{
+        // Unset or zero disables purging.
+        "":     0,
+        "0":    0,
+        "0s":   0,
+        "0d":   0,
+        "90m":  90 * time.Minute,
+        "720h": 720 * time.Hour,
+        "1d":   24 * time.Hour,
+        "30d":  30 * 24 * time.Hour,
+        "730d": 730 * 24 * time.Hour,
+    }
+    for in, want := range valid {
+        got, err := parseRetention(in)
+        if err != nil || got != want {
+            t.Errorf("parseRetention(%q) = %s, %v; want %s", in, got, err, want)
+        }
+    }
+    for _, in := range []string{"-1d", "-5h", "d", "1.5d", "30 days", "30D", "abc", "1w", "1000000d"} {
+        if got, err := parseRetention(in); err == nil {
+            t.Errorf("parseRetention(%q) = %s, want an error", in, got)
+        }
+    }
+}
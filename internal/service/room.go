@@ -0,0 +1,197 @@
+package service
+
+import (
+    "context"
+    "fmt"
+    "strings"
+    "time"
+
+    "github.com/rs/zerolog/log"
+)
+
+// Alert levels.
+const (
+    LevelWarning  = "warning"
+    LevelCritical = "critical"
+)
+
+// Alert conditions; a room has at most one open alert per condition.
+const (
+    ConditionHigh    = "high"
+    ConditionLow     = "low"
+    ConditionOffline = "offline"
+    ConditionTrend   = "trend"
+)
+
+// Room is a cold room with its own temperature profile. Readings outside
+// [WarningMin, WarningMax] raise a warning, readings outside
+// [CriticalMin, CriticalMax] a critical alert. An alert is only raised once
+// the room has been outside the warning band for ExcursionDelaySeconds, and
+// only clears once the temperature is back inside the band by Hysteresis.
+// Sensors report every ReportIntervalSeconds; see OfflineAfter. A rise of
+// more than TrendRise within TrendWindowSeconds raises a predictive trend
+// warning; either being zero disables it.
+type Room struct {
+    ID                    string    `json:"id"`
+    Name                  string    `json:"name"`
+    Type                  string    `json:"type"`
+    CriticalMin           float64   `json:"critical_min"`
+    WarningMin            float64   `json:"warning_min"`
+    WarningMax            float64   `json:"warning_max"`
+    CriticalMax           float64   `json:"critical_max"`
+    Hysteresis            float64   `json:"hysteresis"`
+    ExcursionDelaySeconds int       `json:"excursion_delay_seconds"`
+    ReportIntervalSeconds int       `json:"report_interval_seconds"`
+    OfflineAfterSeconds   int       `json:"offline_after_seconds"`
+    TrendRise             float64   `json:"trend_rise"`
+    TrendWindowSeconds    int       `json:"trend_window_seconds"`
+    CreatedAt             time.Time `json:"created_at"`
+    UpdatedAt             time.Time `json:"updated_at"`
+}
+
+type RoomRequest struct {
+    ID                    string  `json:"id"`
+    Name                  string  `json:"name"`
+    Type                  string  `json:"type"`
+    CriticalMin           float64 `json:"critical_min"`
+    WarningMin            float64 `json:"warning_min"`
+    WarningMax            float64 `json:"warning_max"`
+    CriticalMax           float64 `json:"critical_max"`
+    Hysteresis            float64 `json:"hysteresis"`
+    ExcursionDelaySeconds int     `json:"excursion_delay_seconds"`
+    ReportIntervalSeconds int     `json:"report_interval_seconds"`
+    OfflineAfterSeconds   int     `json:"offline_after_seconds"`
+    TrendRise             float64 `json:"trend_rise"`
+    TrendWindowSeconds    int     `json:"trend_window_seconds"`
+}
+
+func (req RoomRequest) validate() error {
+    if strings.TrimSpace(req.ID) == "" {
+        return fmt.Errorf("%w: id is required", ErrInvalidRequest)
+    }
+    if !(req.CriticalMin <= req.WarningMin && req.WarningMin < req.WarningMax && req.WarningMax <= req.CriticalMax) {
+        return fmt.Errorf("%w: bands must satisfy critical_min <= warning_min < warning_max <= critical_max", ErrInvalidRequest)
+    }
+    if req.Hysteresis < 0 || 2*req.Hysteresis >= req.WarningMax-req.WarningMin {
+        return fmt.Errorf("%w: hysteresis must be >= 0 and less than half the warning band", ErrInvalidRequest)
+    }
+    if req.ExcursionDelaySeconds < 0 || req.ReportIntervalSeconds < 0 || req.OfflineAfterSeconds < 0 || req.TrendWindowSeconds < 0 {
+        return fmt.Errorf("%w: durations must be >= 0", ErrInvalidRequest)
+    }
+    if req.OfflineAfterSeconds > 0 && req.OfflineAfterSeconds < req.ReportIntervalSeconds {
+        return fmt.Errorf("%w: offline_after_seconds must be at least report_interval_seconds", ErrInvalidRequest)
+    }
+    if req.TrendRise < 0 {
+        return fmt.Errorf("%w: trend_rise must be >= 0", ErrInvalidRequest)
+    }
+    return nil
+}
+
+// Level returns the alert level for temp, or "" when it is inside the
+// warning band.
+func (r *Room) Level(temp float64) string {
+    switch {
+    case temp < r.CriticalMin || temp > r.CriticalMax:
+        return LevelCritical
+    case temp < r.WarningMin || temp > r.WarningMax:
+        return LevelWarning
+    }
+    return ""
+}
+
+// Condition returns ConditionHigh or ConditionLow when temp is outside the
+// warning band, or "" when it is inside.
+func (r *Room) Condition(temp float64) string {
+    switch {
+    case temp > r.WarningMax:
+        return ConditionHigh
+    case temp < r.WarningMin:
+        return ConditionLow
+    }
+    return ""
+}
+
+// ExcursionDelay is how long a room must stay outside the warning band
+// before an alert is raised.
+func (r *Room) ExcursionDelay() time.Duration {
+    return time.Duration(r.ExcursionDelaySeconds) * time.Second
+}
+
+// OfflineAfter is the gap without readings after which the room's sensor is
+// considered offline: OfflineAfterSeconds, or three report intervals when
+// unset. Zero disables offline detection for the room.
+func (r *Room) OfflineAfter() time.Duration {
+    if r.OfflineAfterSeconds > 0 {
+        return time.Duration(r.OfflineAfterSeconds) * time.Second
+    }
+    return 3 * time.Duration(r.ReportIntervalSeconds) * time.Second
+}
+
+// TrendWindow is the look-back for rate-of-change rules, or 0 when trend
+// alerting is disabled for the room.
+func (r *Room) TrendWindow() time.Duration {
+    if r.TrendRise <= 0 {
+        return 0
+    }
+    return time.Duration(r.TrendWindowSeconds) * time.Second
+}
+
+// Threshold returns the warning-band edge that defines an excursion for
+// condition.
+func (r *Room) Threshold(condition string) float64 {
+    if condition == ConditionHigh {
+        return r.WarningMax
+    }
+    return r.WarningMin
+}
+
+// Recovered reports whether temp is far enough back inside the warning band
+// to clear an open alert for condition.
+func (r *Room) Recovered(condition string, temp float64) bool {
+    if condition == ConditionHigh {
+        return temp <= r.WarningMax-r.Hysteresis
+    }
+    return temp >= r.WarningMin+r.Hysteresis
+}
+
+type RoomService struct {
+    repo Repo
+}
+
+func NewRoomService(r Repo) *RoomService { return &RoomService{repo: r} }
+
+func (s *RoomService) Create(ctx context.Context, req RoomRequest) (*Room, error) {
+    if err := req.validate(); err != nil { return nil, err }
+    now := time.Now().UTC()
+    room := &Room{ID:strings.TrimSpace(req.ID), Name:req.Name, Type:req.Type, CriticalMin:req.CriticalMin, WarningMin:req.WarningMin, WarningMax:req.WarningMax, CriticalMax:req.CriticalMax, Hysteresis:req.Hysteresis, ExcursionDelaySeconds:req.ExcursionDelaySeconds, ReportIntervalSeconds:req.ReportIntervalSeconds, OfflineAfterSeconds:req.OfflineAfterSeconds, TrendRise:req.TrendRise, TrendWindowSeconds:req.TrendWindowSeconds, CreatedAt:now, UpdatedAt:now}
+    if err := s.repo.CreateRoom(ctx, room); err != nil { return nil, err }
+    log.Info().Str("room", room.ID).Msg("room created")
+    return room, nil
+}
+
+func (s *RoomService) Get(ctx context.Context, id string) (*Room, error) {
+    return s.repo.GetRoom(ctx, id)
+}
+
+func (s *RoomService) List(ctx context.Context) ([]Room, error) {
+    return s.repo.ListRooms(ctx)
+}
+
+// Update replaces the room profile. Ingest reads profiles from the database
+// on every batch, so the change applies to the next reading.
+func (s *RoomService) Update(ctx context.Context, id string, req RoomRequest) (*Room, error) {
+    req.ID = id
+    if err := req.validate(); err != nil { return nil, err }
+    room, err := s.repo.GetRoom(ctx, id)
+    if err != nil { return nil, err }
+    room.Name, room.Type = req.Name, req.Type
+    room.CriticalMin, room.WarningMin, room.WarningMax, room.CriticalMax = req.CriticalMin, req.WarningMin, req.WarningMax, req.CriticalMax
+    room.Hysteresis = req.Hysteresis
+    room.ExcursionDelaySeconds = req.ExcursionDelaySeconds
+    room.ReportIntervalSeconds, room.OfflineAfterSeconds = req.ReportIntervalSeconds, req.OfflineAfterSeconds
+    room.TrendRise, room.TrendWindowSeconds = req.TrendRise, req.TrendWindowSeconds
+    room.UpdatedAt = time.Now().UTC()
+    if err := s.repo.UpdateRoom(ctx, room); err != nil { return nil, err }
+    log.Info().Str("room", room.ID).Msg("room updated")
+    return room, nil
+}
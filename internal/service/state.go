@@ -0,0 +1,67 @@
+package service
+
+import (
+    "errors"
+    "fmt"
+)
+
+// Transfer statuses. A transfer starts as pending and moves forward only
+// along the edges declared in transferTransitions.
+const (
+    StatusPending    = "pending"
+    StatusAccepted   = "accepted"
+    StatusInProgress = "in_progress"
+    StatusCompleted  = "completed"
+    StatusRejected   = "rejected"
+    StatusCancelled  = "cancelled"
+)
+
+var transferTransitions = map[string][]string{
+    StatusPending:    {StatusAccepted, StatusRejected, StatusCancelled},
+    StatusAccepted:   {StatusInProgress, StatusCancelled},
+    StatusInProgress: {StatusCompleted},
+}
+
+// ErrStaleStatus is returned by the repo when a conditional status update
+// finds the row no longer in the expected status (another operator won).
+var ErrStaleStatus = errors.New("transfer status changed concurrently")
+
+// TransitionError reports an illegal status change.
+type TransitionError struct {
+    From string
+    To   string
+}
+
+func (e *TransitionError) Error() string {
+    return fmt.Sprintf("invalid transition %s -> %s", e.From, e.To)
+}
+
+// CanTransition reports whether a transfer in status from may move to status to.
+func CanTransition(from, to string) bool {
+    for _, s := range transferTransitions[from] {
+        if s == to { return true }
+    }
+    return false
+}
+
+// ValidateTransition returns a *TransitionError when from -> to is not allowed.
+func ValidateTransition(from, to string) error {
+    if !CanTransition(from, to) {
+        return &TransitionError{From: from, To: to}
+    }
+    return nil
+}
+
+// IsTransferStatus reports whether status is one of the known statuses.
+func IsTransferStatus(status string) bool {
+    switch status {
+    case StatusPending, StatusAccepted, StatusInProgress, StatusCompleted, StatusRejected, StatusCancelled:
+        return true
+    }
+    return false
+}
+
+// IsTerminal reports whether no further transitions are possible from status.
+func IsTerminal(status string) bool {
+    return len(transferTransitions[status]) == 0
+}
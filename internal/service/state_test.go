@@ -0,0 +1,88 @@
+package service_test
+
+import (
+    "context"
+    "errors"
+    "testing"
+
+    "transfer-service/internal/service"
+)
+
+var allStatuses = []string{service.StatusPending, service.StatusAccepted, service.StatusInProgress, service.StatusCompleted, service.StatusRejected, service.StatusCancelled}
+
+func TestTransitions(t *testing.T) {
+    allowed := map[[2]string]bool{
+        {service.StatusPending, service.StatusAccepted}:     true,
+        {service.StatusPending, service.StatusRejected}:     true,
+        {service.StatusPending, service.StatusCancelled}:    true,
+        {service.StatusAccepted, service.StatusInProgress}:  true,
+        {service.StatusAccepted, service.StatusCancelled}:   true,
+        {service.StatusInProgress, service.StatusCompleted}: true,
+    }
+    for _, from := range allStatuses {
+        for _, to := range allStatuses {
+            want := allowed[[2]string{from, to}]
+            if got := service.CanTransition(from, to); got != want {
+                t.Errorf("CanTransition(%s, %s) = %v, want %v", from, to, got, want)
+            }
+            err := service.ValidateTransition(from, to)
+            if want {
+                if err != nil { t.Errorf("ValidateTransition(%s, %s) = %v, want nil", from, to, err) }
+                continue
+            }
+            var te *service.TransitionError
+            if !errors.As(err, &te) || te.From != from || te.To != to {
+                t.Errorf("ValidateTransition(%s, %s) = %v, want *TransitionError{%s, %s}", from, to, err, from, to)
+            }
+        }
+    }
+    for _, s := range []string{service.StatusCompleted, service.StatusRejected, service.StatusCancelled} {
+        if !service.IsTerminal(s) { t.Errorf("IsTerminal(%s) = false", s) }
+    }
+    if service.IsTransferStatus("shipped") { t.Error(`IsTransferStatus("shipped") = true`) }
+}
+
+// transferRepo serves one transfer and can simulate losing the conditional
+// status update to a concurrent writer. Other Repo methods are not used.
+type transferRepo struct {
+    service.Repo
+    tr    service.Transfer
+    stale bool
+}
+
+func (r *transferRepo) WithTx(ctx context.Context, fn func(service.Repo) error) error { return fn(r) }
+
+func (r *transferRepo) GetTransfer(ctx context.Context, id string) (*service.Transfer, error) {
+    tr := r.tr
+    return &tr, nil
+}
+
+func (r *transferRepo) UpdateTransferStatus(ctx context.Context, id, expected, status string, approvedBy *string) error {
+    if r.stale || expected != r.tr.Status { return service.ErrStaleStatus }
+    r.tr.Status = status
+    return nil
+}
+
+func (r *transferRepo) InsertOutbox(ctx context.Context, aggregateType, aggregateID, topic string, payload interface{}) error {
+    return nil
+}
+
+func TestAcceptTransferErrors(t *testing.T) {
+    ctx := context.Background()
+
+    r := &transferRepo{tr: service.Transfer{ID: "t1", Status: service.StatusCompleted}}
+    err := service.NewTransferService(r).AcceptTransfer(ctx, "t1")
+    var te *service.TransitionError
+    if !errors.As(err, &te) || te.From != service.StatusCompleted || te.To != service.StatusAccepted {
+        t.Fatalf("accept completed transfer: err = %v, want *TransitionError", err)
+    }
+
+    r = &transferRepo{tr: service.Transfer{ID: "t1", Status: service.StatusPending}, stale: true}
+    if err := service.NewTransferService(r).AcceptTransfer(ctx, "t1"); !errors.Is(err, service.ErrStaleStatus) {
+        t.Fatalf("accept with concurrent update: err = %v, want ErrStaleStatus", err)
+    }
+
+    r = &transferRepo{tr: service.Transfer{ID: "t1", Status: service.StatusPending}}
+    if err := service.NewTransferService(r).AcceptTransfer(ctx, "t1"); err != nil { t.Fatalf("accept pending transfer: %v", err) }
+    if r.tr.Status != service.StatusAccepted { t.Fatalf("status = %s, want accepted", r.tr.Status) }
+}
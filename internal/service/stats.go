@@ -0,0 +1,77 @@
+package service
+
+import (
+    "context"
+    "fmt"
+    "time"
+)
+
+type RoomAlertCount struct {
+    RoomID      string    `json:"room_id"`
+    Level       string    `json:"level"`
+    Count       int       `json:"count"`
+    LastAlertAt time.Time `json:"last_alert_at"`
+}
+
+type OperatorStats struct {
+    OperatorID      string    `json:"operator_id"`
+    CompletedMoves  int       `json:"completed_moves"`
+    AvgMoveSeconds  float64   `json:"avg_move_seconds"`
+    AvgDwellSeconds float64   `json:"avg_dwell_seconds"`
+    LastCompletedAt time.Time `json:"last_completed_at"`
+}
+
+// RoomAlertsProjection counts raised temperature alerts per room and level;
+// an alert escalating to critical counts once at each level.
+type RoomAlertsProjection struct{}
+
+func (RoomAlertsProjection) Name() string { return "room_alerts" }
+func (RoomAlertsProjection) Topics() []string {
+    return []string{EventTemperatureAlert, EventTemperatureAlertRaised}
+}
+
+func (RoomAlertsProjection) Apply(ctx context.Context, tx Repo, ev OutboxEvent) error {
+    var evt TemperatureAlertRaised
+    if err := decodeEvent(ev, &evt); err != nil { return err }
+    if evt.RoomID == "" { return fmt.Errorf("%w: %s %s has no room_id", ErrMalformedEvent, ev.Topic, ev.ID) }
+    at := evt.Ts
+    if at.IsZero() { at = ev.CreatedAt }
+    return tx.IncrementRoomAlertCount(ctx, evt.RoomID, evt.Level, at)
+}
+
+func (RoomAlertsProjection) Reset(ctx context.Context, tx Repo) error {
+    return tx.TruncateReadModel(ctx, "room_alert_counts")
+}
+
+// OperatorStatsProjection aggregates completed moves, move duration and
+// dwell time per operator.
+type OperatorStatsProjection struct{}
+
+func (OperatorStatsProjection) Name() string     { return "operator_stats" }
+func (OperatorStatsProjection) Topics() []string { return []string{EventTransferCompleted} }
+
+func (OperatorStatsProjection) Apply(ctx context.Context, tx Repo, ev OutboxEvent) error {
+    var evt TransferCompleted
+    if err := decodeEvent(ev, &evt); err != nil { return err }
+    at := evt.Ts
+    if at.IsZero() { at = ev.CreatedAt }
+    return tx.RecordOperatorMove(ctx, evt.ProcessedBy, evt.MoveDurationSeconds, evt.DwellSeconds, at)
+}
+
+func (OperatorStatsProjection) Reset(ctx context.Context, tx Repo) error {
+    return tx.TruncateReadModel(ctx, "operator_stats")
+}
+
+type StatsService struct {
+    repo Repo
+}
+
+func NewStatsService(r Repo) *StatsService { return &StatsService{repo: r} }
+
+func (s *StatsService) RoomAlertCounts(ctx context.Context) ([]RoomAlertCount, error) {
+    return s.repo.ListRoomAlertCounts(ctx)
+}
+
+func (s *StatsService) OperatorStats(ctx context.Context) ([]OperatorStats, error) {
+    return s.repo.ListOperatorStats(ctx)
+}
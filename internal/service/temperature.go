@@ -2,12 +2,12 @@ package service
 
 import (
     "context"
-    "fmt"
+    "errors"
     "os"
+    "sort"
     "strconv"
     "time"
 
-    "github.com/google/uuid"
     "github.com/rs/zerolog/log"
 )
 
@@ -17,19 +17,38 @@ type TemperatureReading struct {
     Ts     time.Time `json:"ts"`
 }
 
+// Alert is an excursion of one room in one condition. It stays active, with
+// Temp, PeakTemp and DurationSeconds tracking the excursion since
+// ExcursionStartedAt, until ClearedAt is set; Status records acknowledgement
+// and resolution by operators.
 type Alert struct {
-    ID      string    `json:"id"`
-    RoomID  string    `json:"room_id"`
-    Temp    float64   `json:"temp"`
-    Level   string    `json:"level"`
-    Message string    `json:"message"`
-    Created time.Time `json:"created_at"`
+    ID                 string     `json:"id"`
+    RoomID             string     `json:"room_id"`
+    Condition          string     `json:"condition"`
+    Level              string     `json:"level"`
+    Status             string     `json:"status"`
+    Temp               float64    `json:"temp"`
+    PeakTemp           float64    `json:"peak_temp"`
+    Message            string     `json:"message"`
+    AcknowledgedBy     string     `json:"acknowledged_by,omitempty"`
+    AcknowledgeNote    string     `json:"acknowledge_note,omitempty"`
+    ResolvedBy         string     `json:"resolved_by,omitempty"`
+    CorrectiveAction   string     `json:"corrective_action,omitempty"`
+    ExcursionStartedAt time.Time  `json:"excursion_started_at"`
+    DurationSeconds    float64    `json:"duration_seconds"`
+    Created            time.Time  `json:"created_at"`
+    UpdatedAt          time.Time  `json:"updated_at"`
+    ClearedAt          *time.Time `json:"cleared_at,omitempty"`
+    AcknowledgedAt     *time.Time `json:"acknowledged_at,omitempty"`
+    ResolvedAt         *time.Time `json:"resolved_at,omitempty"`
 }
 
 type TemperatureService struct {
-    repo Repo
-    min float64
-    max float64
+    repo         Repo
+    // fallback is used for readings from rooms without a profile in the
+    // rooms table; TEMP_MIN/TEMP_MAX become its critical band.
+    fallback     Room
+    offlineCheck time.Duration
 }
 
 func NewTemperatureService(r Repo) *TemperatureService {
@@ -41,28 +60,90 @@ func NewTemperatureService(r Repo) *TemperatureService {
     if v := os.Getenv("TEMP_MAX"); v != "" {
         if f, err := strconv.ParseFloat(v, 64); err == nil { max = f }
     }
-    return &TemperatureService{repo: r, min: min, max: max}
+    hysteresis := 0.5
+    if v := os.Getenv("TEMP_HYSTERESIS"); v != "" {
+        if f, err := strconv.ParseFloat(v, 64); err == nil && f >= 0 { hysteresis = f }
+    }
+    var delay time.Duration
+    if v := os.Getenv("TEMP_EXCURSION_DELAY"); v != "" {
+        if d, err := time.ParseDuration(v); err == nil && d >= 0 { delay = d }
+    }
+    var trendRise float64
+    if v := os.Getenv("TEMP_TREND_RISE"); v != "" {
+        if f, err := strconv.ParseFloat(v, 64); err == nil && f >= 0 { trendRise = f }
+    }
+    trendWindow := 15 * time.Minute
+    if v := os.Getenv("TEMP_TREND_WINDOW"); v != "" {
+        if d, err := time.ParseDuration(v); err == nil && d >= 0 { trendWindow = d }
+    }
+    fallback := Room{CriticalMin: min, WarningMin: min, WarningMax: max, CriticalMax: max, Hysteresis: hysteresis, ExcursionDelaySeconds: int(delay / time.Second), TrendRise: trendRise, TrendWindowSeconds: int(trendWindow / time.Second)}
+    offlineCheck := 30 * time.Second
+    if v := os.Getenv("TEMP_OFFLINE_CHECK_INTERVAL"); v != "" {
+        if d, err := time.ParseDuration(v); err == nil && d > 0 { offlineCheck = d }
+    }
+    return &TemperatureService{repo: r, fallback: fallback, offlineCheck: offlineCheck}
 }
 
-func (s *TemperatureService) Ingest(ctx context.Context, readings []TemperatureReading) error {
+// lockRooms takes the alert lock of every room in the batch, in sorted order
+// before anything is written, so batches that mention the same rooms in a
+// different order cannot deadlock. It returns each room's profile; profiles
+// are not cached across batches so edits through the rooms API apply
+// immediately.
+func (s *TemperatureService) lockRooms(ctx context.Context, tx Repo, readings []TemperatureReading) (map[string]*Room, error) {
+    rooms := map[string]*Room{}
+    var ids []string
     for _, rd := range readings {
-        if rd.Ts.IsZero() {
-            rd.Ts = time.Now().UTC()
-        }
-        if err := s.repo.InsertReading(ctx, rd); err != nil {
-            return err
-        }
-        if rd.Temp < s.min || rd.Temp > s.max {
-            a := &Alert{ID: uuid.New().String(), RoomID: rd.RoomID, Temp: rd.Temp, Level: "critical", Message: fmt.Sprintf("temp %.2f out of bounds (%.2f..%.2f)", rd.Temp, s.min, s.max), Created: time.Now().UTC()}
-            if err := s.repo.CreateAlert(ctx, a); err != nil { return err }
-            evt := map[string]interface{}{"room_id":a.RoomID, "temp":a.Temp, "level":a.Level, "message":a.Message, "ts":a.Created.Format(time.RFC3339)}
-            if err := s.repo.InsertOutbox(ctx, "temperature", a.ID, "temperature.alert", evt); err != nil { return err }
-            log.Info().Str("event","temperature.alert").Str("room",a.RoomID).Float64("temp",a.Temp).Msg("alert created")
+        if _, ok := rooms[rd.RoomID]; ok { continue }
+        rooms[rd.RoomID] = nil
+        ids = append(ids, rd.RoomID)
+    }
+    sort.Strings(ids)
+    for _, id := range ids {
+        if err := tx.LockRoomAlerts(ctx, id); err != nil { return nil, err }
+        room, err := tx.GetRoom(ctx, id)
+        if errors.Is(err, ErrNotFound) {
+            fb := s.fallback
+            fb.ID = id
+            room, err = &fb, nil
         }
+        if err != nil { return nil, err }
+        rooms[id] = room
     }
-    return nil
+    return rooms, nil
 }
 
-func (s *TemperatureService) ListAlerts(ctx context.Context) ([]Alert, error) {
-    return s.repo.ListAlerts(ctx)
+func (s *TemperatureService) Ingest(ctx context.Context, readings []TemperatureReading) error {
+    var changes []alertChange
+    err := s.repo.WithTx(ctx, func(tx Repo) error {
+        rooms, err := s.lockRooms(ctx, tx, readings)
+        if err != nil { return err }
+        for _, rd := range readings {
+            if rd.Ts.IsZero() {
+                rd.Ts = time.Now().UTC()
+            }
+            if err := tx.InsertReading(ctx, rd); err != nil {
+                return err
+            }
+            if err := tx.UpsertRollups(ctx, rd); err != nil { return err }
+            room := rooms[rd.RoomID]
+            // The heartbeat is written under the room's alert lock so the
+            // offline monitor never sees a stale one for this batch.
+            if err := tx.TouchHeartbeat(ctx, rd); err != nil { return err }
+            c, err := clearOffline(ctx, tx, rd)
+            if err != nil { return err }
+            changes = append(changes, c...)
+            c, err = evaluateBands(ctx, tx, room, rd)
+            if err != nil { return err }
+            changes = append(changes, c...)
+            c, err = evaluateTrend(ctx, tx, room, rd)
+            if err != nil { return err }
+            changes = append(changes, c...)
+        }
+        return nil
+    })
+    if err != nil { return err }
+    for _, c := range changes {
+        log.Info().Str("event",c.event).Str("room",c.alert.RoomID).Str("condition",c.alert.Condition).Str("level",c.alert.Level).Float64("temp",c.alert.Temp).Msg("alert changed")
+    }
+    return nil
 }
@@ -3,8 +3,8 @@ package service
 import (
     "context"
     "errors"
+    "fmt"
     "os"
-    "strconv"
     "time"
 
     "github.com/google/uuid"
@@ -18,90 +18,299 @@ type CreateTransferRequest struct {
     RequestedBy  string `json:"requested_by"`
 }
 
+type RejectTransferRequest struct {
+    RejectedBy string `json:"rejected_by"`
+    Reason     string `json:"reason"`
+}
+
+type CancelTransferRequest struct {
+    CancelledBy string `json:"cancelled_by"`
+    Reason      string `json:"reason"`
+}
+
+type StartTransferRequest struct {
+    OperatorID  string `json:"operator_id"`
+    EquipmentID string `json:"equipment_id"`
+}
+
 type Transfer struct {
-    ID           string    `json:"id"`
-    PalletID     string    `json:"pallet_id"`
-    FromLocation string    `json:"from_location"`
-    ToLocation   string    `json:"to_location"`
-    Status       string    `json:"status"`
-    RequestedBy  string    `json:"requested_by"`
-    ApprovedBy   *string   `json:"approved_by,omitempty"`
-    CreatedAt    time.Time `json:"created_at"`
-    UpdatedAt    time.Time `json:"updated_at"`
+    ID                  string     `json:"id"`
+    PalletID            string     `json:"pallet_id"`
+    FromLocation        string     `json:"from_location"`
+    ToLocation          string     `json:"to_location"`
+    Status              string     `json:"status"`
+    RequestedBy         string     `json:"requested_by"`
+    ApprovedBy          *string    `json:"approved_by,omitempty"`
+    RejectedBy          *string    `json:"rejected_by,omitempty"`
+    CancelledBy         *string    `json:"cancelled_by,omitempty"`
+    Reason              *string    `json:"reason,omitempty"`
+    OperatorID          *string    `json:"operator_id,omitempty"`
+    EquipmentID         *string    `json:"equipment_id,omitempty"`
+    AcceptedAt          *time.Time `json:"accepted_at,omitempty"`
+    StartedAt           *time.Time `json:"started_at,omitempty"`
+    CompletedAt         *time.Time `json:"completed_at,omitempty"`
+    MoveDurationSeconds *float64   `json:"move_duration_seconds,omitempty"`
+    CreatedAt           time.Time  `json:"created_at"`
+    UpdatedAt           time.Time  `json:"updated_at"`
 }
 
 var (
     ErrNotFound         = errors.New("not found")
     ErrCapacityExceeded = errors.New("capacity exceeded")
+    ErrInvalidRequest   = errors.New("invalid request")
+    ErrForbidden        = errors.New("forbidden")
+    ErrConflict         = errors.New("conflict")
 )
 
 type Repo interface {
+    // WithTx runs fn against a repo bound to one database transaction so a
+    // state change and its outbox row commit or roll back together.
+    WithTx(ctx context.Context, fn func(Repo) error) error
     CreateTransfer(ctx context.Context, t *Transfer, idempotencyKey string) error
     GetTransfer(ctx context.Context, id string) (*Transfer, error)
-    UpdateTransferStatus(ctx context.Context, id, status string, approvedBy *string) error
+    // ListTransfers returns up to limit transfers matching f, strictly after
+    // the cursor in the filter's sort order.
+    ListTransfers(ctx context.Context, f TransferFilter, after *TransferCursor, limit int) ([]Transfer, error)
+    // UpdateTransferStatus moves a transfer from expected to status and
+    // returns ErrStaleStatus if the row is no longer in expected.
+    UpdateTransferStatus(ctx context.Context, id, expected, status string, approvedBy *string) error
+    // CloseTransfer moves a transfer from expected to a terminal status
+    // (rejected/cancelled), recording who closed it and why.
+    CloseTransfer(ctx context.Context, id, expected, status, actor, reason string) error
+    StartTransfer(ctx context.Context, id, expected, operatorID, equipmentID string, startedAt time.Time) error
+    CompleteTransfer(ctx context.Context, id, expected string, completedAt time.Time, moveDuration time.Duration) error
     CountByDestination(ctx context.Context, to string) (int, error)
     InsertOutbox(ctx context.Context, aggregateType, aggregateID, topic string, payload interface{}) error
-    FlushOutboxAndMark(ctx context.Context, outboxDir string) error
+    // ClaimOutboxBatch leases due events until lockedUntil without keeping a
+    // transaction open; MarkOutboxPublished/MarkOutboxFailed settle them.
+    ClaimOutboxBatch(ctx context.Context, limit int, now, lockedUntil time.Time) ([]OutboxEvent, error)
+    MarkOutboxPublished(ctx context.Context, ids []string) error
+    MarkOutboxFailed(ctx context.Context, id, lastError string, nextAttemptAt time.Time, deadLetter bool) error
+    ListDeadLetters(ctx context.Context, limit int) ([]OutboxEvent, error)
+    // RequeueDeadLetter returns ErrNotFound if id is not dead-lettered.
+    RequeueDeadLetter(ctx context.Context, id string) error
+    // ListOutboxAfter reads the outbox as an ordered event log (by xid, seq),
+    // holding back rows whose writing transaction may still be in flight.
+    ListOutboxAfter(ctx context.Context, after OutboxPosition, topics []string, limit int) ([]OutboxEvent, error)
+    CountOutboxAfter(ctx context.Context, afterSeq int64, topics []string) (int, error)
+    // Projection checkpoints. GetCheckpoint locks the row until the
+    // surrounding transaction ends.
+    GetCheckpoint(ctx context.Context, name string) (OutboxPosition, error)
+    SaveCheckpoint(ctx context.Context, name string, pos OutboxPosition) error
+    // TruncateReadModel empties projection-owned tables before a rebuild.
+    TruncateReadModel(ctx context.Context, tables ...string) error
+    // Inventory read model
+    MovePallet(ctx context.Context, palletID, toLocation, transferID string, at time.Time) error
+    GetLocationInventory(ctx context.Context, locationID string) (*LocationInventory, error)
+    GetPalletInventory(ctx context.Context, palletID string) (*PalletInventory, error)
+    // Stats read models
+    IncrementRoomAlertCount(ctx context.Context, roomID, level string, at time.Time) error
+    ListRoomAlertCounts(ctx context.Context) ([]RoomAlertCount, error)
+    RecordOperatorMove(ctx context.Context, operatorID string, moveSeconds float64, dwellSeconds *float64, at time.Time) error
+    ListOperatorStats(ctx context.Context) ([]OperatorStats, error)
+    // Location master data
+    CreateLocation(ctx context.Context, l *Location) error
+    GetLocation(ctx context.Context, code string) (*Location, error)
+    // LockLocation is GetLocation with SELECT ... FOR UPDATE; use inside WithTx.
+    LockLocation(ctx context.Context, code string) (*Location, error)
+    ListLocations(ctx context.Context, activeOnly bool) ([]Location, error)
+    UpdateLocation(ctx context.Context, l *Location) error
+    // Pallet registry
+    CreatePallet(ctx context.Context, p *Pallet) error
+    GetPallet(ctx context.Context, sscc string) (*Pallet, error)
+    LockPallet(ctx context.Context, sscc string) (*Pallet, error)
+    ListPallets(ctx context.Context, location string) ([]Pallet, error)
+    UpdatePalletLocation(ctx context.Context, sscc, location, status string, at time.Time) error
+    HasOpenTransfer(ctx context.Context, palletID string) (bool, error)
+    // Idempotency store. ReserveIdempotencyKey returns reserved=true when the
+    // key was free, expired, or an abandoned in-flight reservation of the same
+    // request; otherwise it returns the existing record.
+    ReserveIdempotencyKey(ctx context.Context, key, requestHash, token string, now, leaseExpiresAt, expiresAt time.Time) (*IdempotencyRecord, bool, error)
+    PurgeIdempotencyKeys(ctx context.Context, now time.Time) (int64, error)
+    // SaveIdempotencyResponse and DeleteIdempotencyKey only touch the
+    // reservation owned by token.
+    SaveIdempotencyResponse(ctx context.Context, key, token string, statusCode int, body []byte) error
+    DeleteIdempotencyKey(ctx context.Context, key, token string) error
     // Temperature methods are also in same repo implementation
+    CreateRoom(ctx context.Context, r *Room) error
+    GetRoom(ctx context.Context, id string) (*Room, error)
+    ListRooms(ctx context.Context) ([]Room, error)
+    UpdateRoom(ctx context.Context, r *Room) error
+    LockRoomAlerts(ctx context.Context, roomID string) error
+    TouchHeartbeat(ctx context.Context, rd TemperatureReading) error
+    GetHeartbeat(ctx context.Context, roomID string) (*RoomHeartbeat, error)
+    ListOfflineCandidates(ctx context.Context, now time.Time) ([]Room, error)
+    ListReadings(ctx context.Context, roomID string, from, to time.Time, limit int) ([]TemperatureReading, error)
+    BucketReadings(ctx context.Context, roomID string, from, to time.Time, bucket time.Duration) ([]TemperatureBucket, error)
+    UpsertRollups(ctx context.Context, rd TemperatureReading) error
+    BucketRollup(ctx context.Context, roomID string, resolution time.Duration, from, to time.Time, bucket time.Duration) ([]TemperatureBucket, error)
+    OldestReadingAt(ctx context.Context) (*time.Time, error)
+    RebuildRollups(ctx context.Context, since time.Time) error
+    ExpiredDays(ctx context.Context, pol RetentionPolicy, cutoff time.Time) ([]time.Time, error)
+    // PurgeExpiredBatch deletes up to limit expired rows of one day, passing
+    // each to fn, and adds them to the purged row count PurgedRows reports.
+    PurgeExpiredBatch(ctx context.Context, pol RetentionPolicy, day time.Time, limit int, fn func(id string, row []byte) error) (int, error)
+    PurgedRows(ctx context.Context, table string) (int64, error)
+    MinTempBetween(ctx context.Context, roomID string, from, to time.Time) (float64, int, error)
+    ExcursionWindow(ctx context.Context, roomID, condition string, threshold float64, at time.Time) (*ExcursionWindow, error)
+    GetOpenAlert(ctx context.Context, roomID, condition string) (*Alert, error)
+    UpdateAlert(ctx context.Context, a *Alert) error
+    GetAlert(ctx context.Context, id string) (*Alert, error)
+    LockAlert(ctx context.Context, id string) (*Alert, error)
     InsertReading(ctx context.Context, r TemperatureReading) error
     CreateAlert(ctx context.Context, a *Alert) error
-    ListAlerts(ctx context.Context) ([]Alert, error)
+    ListAlerts(ctx context.Context, f AlertFilter) ([]Alert, error)
 }
 
 type TransferService struct{
     repo Repo
-    maxCapacity int
     validateCap bool
 }
 
 func NewTransferService(r Repo) *TransferService{
-    max := 5
-    if v := os.Getenv("MAX_CAPACITY_PER_LOCATION"); v != "" {
-        if n, err := strconv.Atoi(v); err == nil { max = n }
-    }
     validate := true
     if v := os.Getenv("VALIDATE_CAPACITY"); v != "" {
         validate = !(v == "false" || v == "0")
     }
-    return &TransferService{repo: r, maxCapacity: max, validateCap: validate}
+    return &TransferService{repo: r, validateCap: validate}
 }
 
 func (s *TransferService) CreateTransfer(ctx context.Context, req CreateTransferRequest, idempotencyKey string) (*Transfer, error) {
-    if s.validateCap {
-        count, err := s.repo.CountByDestination(ctx, req.ToLocation)
-        if err != nil { return nil, err }
-        if count >= s.maxCapacity { return nil, ErrCapacityExceeded }
+    if req.PalletID == "" || req.RequestedBy == "" {
+        return nil, fmt.Errorf("%w: pallet_id and requested_by are required", ErrInvalidRequest)
+    }
+    if req.FromLocation == req.ToLocation {
+        return nil, fmt.Errorf("%w: from_location and to_location must differ", ErrInvalidRequest)
     }
     id := uuid.New().String()
     now := time.Now().UTC()
-    tr := &Transfer{ID:id, PalletID:req.PalletID, FromLocation:req.FromLocation, ToLocation:req.ToLocation, Status:"pending", RequestedBy:req.RequestedBy, CreatedAt:now, UpdatedAt:now}
-    if err := s.repo.CreateTransfer(ctx, tr, idempotencyKey); err != nil {
-        return nil, err
-    }
-    evt := map[string]interface{}{"transfer_id":tr.ID, "pallet_id":tr.PalletID, "from":tr.FromLocation, "to":tr.ToLocation, "status":tr.Status, "requested_by":tr.RequestedBy, "ts":tr.CreatedAt.Format(time.RFC3339)}
-    if err := s.repo.InsertOutbox(ctx, "transfer", tr.ID, "transfer.created", evt); err != nil { return nil, err }
-    log.Info().Str("event","transfer.created").Str("id",tr.ID).Msg("transfer created")
+    tr := &Transfer{ID:id, PalletID:req.PalletID, FromLocation:req.FromLocation, ToLocation:req.ToLocation, Status:StatusPending, RequestedBy:req.RequestedBy, CreatedAt:now, UpdatedAt:now}
+    err := s.repo.WithTx(ctx, func(tx Repo) error {
+        // The pallet row lock makes the open-transfer check and the insert
+        // atomic per pallet.
+        pallet, err := tx.LockPallet(ctx, req.PalletID)
+        if errors.Is(err, ErrNotFound) { return fmt.Errorf("%w: pallet %q is not registered", ErrInvalidRequest, req.PalletID) }
+        if err != nil { return err }
+        if pallet.CurrentLocation != req.FromLocation {
+            return fmt.Errorf("%w: pallet %s is at %s, not %s", ErrConflict, pallet.SSCC, pallet.CurrentLocation, req.FromLocation)
+        }
+        open, err := tx.HasOpenTransfer(ctx, req.PalletID)
+        if err != nil { return err }
+        if open { return fmt.Errorf("%w: pallet %s already has an open transfer", ErrConflict, pallet.SSCC) }
+        if _, err := activeLocation(ctx, tx, req.FromLocation, "from_location", false); err != nil { return err }
+        // Locking the destination row serialises concurrent creates for the
+        // same slot, so the count below cannot go stale before the insert.
+        dest, err := activeLocation(ctx, tx, req.ToLocation, "to_location", s.validateCap)
+        if err != nil { return err }
+        if s.validateCap {
+            count, err := tx.CountByDestination(ctx, req.ToLocation)
+            if err != nil { return err }
+            if count >= dest.Capacity { return ErrCapacityExceeded }
+        }
+        if err := tx.CreateTransfer(ctx, tr, idempotencyKey); err != nil { return err }
+        evt := TransferCreated{TransferID:tr.ID, PalletID:tr.PalletID, From:tr.FromLocation, To:tr.ToLocation, Status:tr.Status, RequestedBy:tr.RequestedBy, Ts:tr.CreatedAt}
+        return tx.InsertOutbox(ctx, AggregateTransfer, tr.ID, EventTransferCreated, evt)
+    })
+    if err != nil { return nil, err }
+    log.Info().Str("event",EventTransferCreated).Str("id",tr.ID).Msg("transfer created")
     return tr, nil
 }
 
 func (s *TransferService) AcceptTransfer(ctx context.Context, id string) error {
-    _, err := s.repo.GetTransfer(ctx, id)
-    if err != nil { return ErrNotFound }
     approved := "supervisor"
-    if err := s.repo.UpdateTransferStatus(ctx, id, "accepted", &approved); err != nil { return err }
-    evt := map[string]interface{}{"transfer_id":id, "approved_by":approved, "ts":time.Now().Format(time.RFC3339)}
-    if err := s.repo.InsertOutbox(ctx, "transfer", id, "transfer.accepted", evt); err != nil { return err }
-    log.Info().Str("event","transfer.accepted").Str("id",id).Msg("transfer accepted")
+    err := s.repo.WithTx(ctx, func(tx Repo) error {
+        tr, err := tx.GetTransfer(ctx, id)
+        if err != nil { return ErrNotFound }
+        if err := ValidateTransition(tr.Status, StatusAccepted); err != nil { return err }
+        if err := tx.UpdateTransferStatus(ctx, id, tr.Status, StatusAccepted, &approved); err != nil { return err }
+        evt := TransferAccepted{TransferID:id, ApprovedBy:approved, Ts:time.Now().UTC()}
+        return tx.InsertOutbox(ctx, AggregateTransfer, id, EventTransferAccepted, evt)
+    })
+    if err != nil { return err }
+    log.Info().Str("event",EventTransferAccepted).Str("id",id).Msg("transfer accepted")
     return nil
 }
 
+// StartTransfer records the operator and equipment that picked up the pallet.
+func (s *TransferService) StartTransfer(ctx context.Context, id string, req StartTransferRequest) error {
+    if req.OperatorID == "" || req.EquipmentID == "" {
+        return fmt.Errorf("%w: operator_id and equipment_id are required", ErrInvalidRequest)
+    }
+    err := s.repo.WithTx(ctx, func(tx Repo) error {
+        tr, err := tx.GetTransfer(ctx, id)
+        if err != nil { return ErrNotFound }
+        if err := ValidateTransition(tr.Status, StatusInProgress); err != nil { return err }
+        now := time.Now().UTC()
+        if err := tx.StartTransfer(ctx, id, tr.Status, req.OperatorID, req.EquipmentID, now); err != nil { return err }
+        if err := tx.UpdatePalletLocation(ctx, tr.PalletID, tr.FromLocation, PalletInTransit, now); err != nil { return err }
+        evt := TransferStarted{TransferID:id, PalletID:tr.PalletID, OperatorID:req.OperatorID, EquipmentID:req.EquipmentID, Ts:now}
+        return tx.InsertOutbox(ctx, AggregateTransfer, id, EventTransferStarted, evt)
+    })
+    if err != nil { return err }
+    log.Info().Str("event",EventTransferStarted).Str("id",id).Str("operator",req.OperatorID).Msg("transfer started")
+    return nil
+}
+
+// CompleteTransfer closes an in-progress move. The move duration is measured
+// from start, the dwell time from acceptance.
 func (s *TransferService) CompleteTransfer(ctx context.Context, id string) error {
-    _, err := s.repo.GetTransfer(ctx, id)
-    if err != nil { return ErrNotFound }
-    if err := s.repo.UpdateTransferStatus(ctx, id, "completed", nil); err != nil { return err }
-    evt := map[string]interface{}{"transfer_id":id, "processed_by":"operator","ts":time.Now().Format(time.RFC3339)}
-    if err := s.repo.InsertOutbox(ctx, "transfer", id, "transfer.completed", evt); err != nil { return err }
-    log.Info().Str("event","transfer.completed").Str("id",id).Msg("transfer completed")
+    err := s.repo.WithTx(ctx, func(tx Repo) error {
+        tr, err := tx.GetTransfer(ctx, id)
+        if err != nil { return ErrNotFound }
+        if err := ValidateTransition(tr.Status, StatusCompleted); err != nil { return err }
+        now := time.Now().UTC()
+        var moveDuration time.Duration
+        if tr.StartedAt != nil { moveDuration = now.Sub(*tr.StartedAt) }
+        if err := tx.CompleteTransfer(ctx, id, tr.Status, now, moveDuration); err != nil { return err }
+        if err := tx.UpdatePalletLocation(ctx, tr.PalletID, tr.ToLocation, PalletStored, now); err != nil { return err }
+        evt := TransferCompleted{TransferID:id, PalletID:tr.PalletID, From:tr.FromLocation, To:tr.ToLocation, ProcessedBy:"operator", MoveDurationSeconds:moveDuration.Seconds(), Ts:now}
+        if tr.OperatorID != nil { evt.ProcessedBy = *tr.OperatorID }
+        if tr.EquipmentID != nil { evt.EquipmentID = *tr.EquipmentID }
+        if tr.AcceptedAt != nil {
+            dwell := now.Sub(*tr.AcceptedAt).Seconds()
+            evt.DwellSeconds = &dwell
+        }
+        return tx.InsertOutbox(ctx, AggregateTransfer, id, EventTransferCompleted, evt)
+    })
+    if err != nil { return err }
+    log.Info().Str("event",EventTransferCompleted).Str("id",id).Msg("transfer completed")
+    return nil
+}
+
+func (s *TransferService) RejectTransfer(ctx context.Context, id string, req RejectTransferRequest) error {
+    if req.RejectedBy == "" || req.Reason == "" {
+        return fmt.Errorf("%w: rejected_by and reason are required", ErrInvalidRequest)
+    }
+    err := s.repo.WithTx(ctx, func(tx Repo) error {
+        tr, err := tx.GetTransfer(ctx, id)
+        if err != nil { return ErrNotFound }
+        if err := ValidateTransition(tr.Status, StatusRejected); err != nil { return err }
+        if err := tx.CloseTransfer(ctx, id, tr.Status, StatusRejected, req.RejectedBy, req.Reason); err != nil { return err }
+        evt := TransferRejected{TransferID:id, PalletID:tr.PalletID, To:tr.ToLocation, RejectedBy:req.RejectedBy, Reason:req.Reason, Ts:time.Now().UTC()}
+        return tx.InsertOutbox(ctx, AggregateTransfer, id, EventTransferRejected, evt)
+    })
+    if err != nil { return err }
+    log.Info().Str("event",EventTransferRejected).Str("id",id).Msg("transfer rejected")
+    return nil
+}
+
+func (s *TransferService) CancelTransfer(ctx context.Context, id string, req CancelTransferRequest) error {
+    if req.CancelledBy == "" {
+        return fmt.Errorf("%w: cancelled_by is required", ErrInvalidRequest)
+    }
+    err := s.repo.WithTx(ctx, func(tx Repo) error {
+        tr, err := tx.GetTransfer(ctx, id)
+        if err != nil { return ErrNotFound }
+        if tr.RequestedBy != req.CancelledBy {
+            return fmt.Errorf("%w: only the requester can cancel a transfer", ErrForbidden)
+        }
+        if err := ValidateTransition(tr.Status, StatusCancelled); err != nil { return err }
+        if err := tx.CloseTransfer(ctx, id, tr.Status, StatusCancelled, req.CancelledBy, req.Reason); err != nil { return err }
+        evt := TransferCancelled{TransferID:id, PalletID:tr.PalletID, To:tr.ToLocation, CancelledBy:req.CancelledBy, Reason:req.Reason, Ts:time.Now().UTC()}
+        return tx.InsertOutbox(ctx, AggregateTransfer, id, EventTransferCancelled, evt)
+    })
+    if err != nil { return err }
+    log.Info().Str("event",EventTransferCancelled).Str("id",id).Msg("transfer cancelled")
     return nil
 }
 
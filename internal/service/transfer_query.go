@@ -0,0 +1,89 @@
+package service
+
+import (
+    "context"
+    "encoding/base64"
+    "fmt"
+    "strings"
+    "time"
+)
+
+const (
+    defaultTransferPageSize = 50
+    maxTransferPageSize     = 200
+)
+
+// TransferFilter narrows GET /transfers. Empty fields are ignored; Status
+// matches any of the given statuses.
+type TransferFilter struct {
+    Status       []string
+    PalletID     string
+    FromLocation string
+    ToLocation   string
+    RequestedBy  string
+    CreatedFrom  *time.Time
+    CreatedTo    *time.Time
+    Ascending    bool
+    Limit        int
+    Cursor       string
+}
+
+// TransferCursor is the keyset position (created_at, id) of the last row of
+// a page, together with the sort order it was issued for.
+type TransferCursor struct {
+    CreatedAt time.Time
+    ID        string
+    Ascending bool
+}
+
+type TransferPage struct {
+    Items      []Transfer `json:"items"`
+    NextCursor string     `json:"next_cursor,omitempty"`
+}
+
+func EncodeTransferCursor(c TransferCursor) string {
+    order := "desc"
+    if c.Ascending { order = "asc" }
+    raw := order + "|" + c.CreatedAt.UTC().Format(time.RFC3339Nano) + "|" + c.ID
+    return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func DecodeTransferCursor(s string) (*TransferCursor, error) {
+    raw, err := base64.RawURLEncoding.DecodeString(s)
+    if err != nil { return nil, fmt.Errorf("%w: malformed cursor", ErrInvalidRequest) }
+    parts := strings.SplitN(string(raw), "|", 3)
+    if len(parts) != 3 || (parts[0] != "asc" && parts[0] != "desc") || parts[2] == "" {
+        return nil, fmt.Errorf("%w: malformed cursor", ErrInvalidRequest)
+    }
+    ts, err := time.Parse(time.RFC3339Nano, parts[1])
+    if err != nil { return nil, fmt.Errorf("%w: malformed cursor", ErrInvalidRequest) }
+    return &TransferCursor{CreatedAt: ts, ID: parts[2], Ascending: parts[0] == "asc"}, nil
+}
+
+// ListTransfers returns one page of transfers ordered by (created_at, id),
+// newest first unless f.Ascending. Pass NextCursor back as f.Cursor to get
+// the following page; it is empty on the last page.
+func (s *TransferService) ListTransfers(ctx context.Context, f TransferFilter) (*TransferPage, error) {
+    if f.Limit <= 0 { f.Limit = defaultTransferPageSize }
+    if f.Limit > maxTransferPageSize { f.Limit = maxTransferPageSize }
+    for _, st := range f.Status {
+        if !IsTransferStatus(st) { return nil, fmt.Errorf("%w: unknown status %q", ErrInvalidRequest, st) }
+    }
+    var after *TransferCursor
+    if f.Cursor != "" {
+        c, err := DecodeTransferCursor(f.Cursor)
+        if err != nil { return nil, err }
+        if c.Ascending != f.Ascending { return nil, fmt.Errorf("%w: cursor was issued for a different order", ErrInvalidRequest) }
+        after = c
+    }
+    items, err := s.repo.ListTransfers(ctx, f, after, f.Limit+1)
+    if err != nil { return nil, err }
+    page := &TransferPage{Items: items}
+    if len(items) > f.Limit {
+        page.Items = items[:f.Limit]
+        last := page.Items[f.Limit-1]
+        page.NextCursor = EncodeTransferCursor(TransferCursor{CreatedAt: last.CreatedAt, ID: last.ID, Ascending: f.Ascending})
+    }
+    if page.Items == nil { page.Items = []Transfer{} }
+    return page, nil
+}
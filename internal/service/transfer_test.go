@@ -0,0 +1,55 @@
+package service_test
+
+import (
+    "context"
+    "errors"
+    "sync"
+    "testing"
+
+    "transfer-service/internal/service"
+)
+
+func TestCreateTransferConcurrentLastSlot(t *testing.T) {
+    r := testRepo(t)
+    t.Setenv("VALIDATE_CAPACITY", "true")
+    ctx := context.Background()
+    src := createLocation(t, r, 50)
+    dst := createLocation(t, r, 1)
+
+    const n = 8
+    pallets := service.NewPalletService(r)
+    ids := make([]string, n)
+    for i := range ids {
+        p, err := pallets.Register(ctx, service.RegisterPalletRequest{SSCC: uniqueID("SSCC"), SKU: "SKU-1", Quantity: 1, Location: src})
+        if err != nil { t.Fatalf("register pallet: %v", err) }
+        ids[i] = p.SSCC
+    }
+
+    transfers := service.NewTransferService(r)
+    errs := make([]error, n)
+    var wg sync.WaitGroup
+    start := make(chan struct{})
+    for i := range ids {
+        wg.Add(1)
+        go func(i int) {
+            defer wg.Done()
+            <-start
+            req := service.CreateTransferRequest{PalletID: ids[i], FromLocation: src, ToLocation: dst, RequestedBy: "tester"}
+            _, errs[i] = transfers.CreateTransfer(ctx, req, "")
+        }(i)
+    }
+    close(start)
+    wg.Wait()
+
+    created := 0
+    for i, err := range errs {
+        switch {
+        case err == nil:
+            created++
+        case errors.Is(err, service.ErrCapacityExceeded):
+        default:
+            t.Errorf("pallet %s: unexpected error: %v", ids[i], err)
+        }
+    }
+    if created != 1 { t.Fatalf("created %d transfers into a location with one free slot, want 1", created) }
+}